@@ -0,0 +1,68 @@
+package camembert
+
+import (
+	"context"
+	"fmt"
+)
+
+// defaultChunkSize is the number of issues handed to Config.OnChunk at a time
+// when Config.ChunkSize is not set.
+const defaultChunkSize = 1000
+
+// chunkWriter hands the issues to Config.OnChunk in chunks of ChunkSize, the
+// last one possibly smaller, as they are written.
+type chunkWriter struct {
+	e       *exporter
+	size    int
+	pending []JiraIssue
+}
+
+func (e *exporter) newChunkWriter() *chunkWriter {
+	size := e.cfg.ChunkSize
+	if size == 0 {
+		size = defaultChunkSize
+	}
+	return &chunkWriter{e: e, size: size}
+}
+
+func (w *chunkWriter) WriteIssues(ctx context.Context, issues []JiraIssue) error {
+	w.pending = append(w.pending, issues...)
+	for len(w.pending) >= w.size {
+		if err := w.send(w.pending[:w.size]); err != nil {
+			return err
+		}
+		w.pending = w.pending[w.size:]
+	}
+	return nil
+}
+
+// send hands chunk to the callback. Its errors fail the export in Strict
+// mode, and are otherwise logged with the issues of the chunk counted as
+// skipped.
+func (w *chunkWriter) send(chunk []JiraIssue) error {
+	err := w.e.cfg.OnChunk(append([]JiraIssue(nil), chunk...))
+	if err == nil {
+		return nil
+	}
+	if w.e.cfg.Strict {
+		return fmt.Errorf("failed to hand a chunk of %d issues: %w", len(chunk), err)
+	}
+	w.e.logger.Printf("Warning: failed to hand a chunk of %d issues, skipping them: %v", len(chunk), err)
+	w.e.stats.skipped.Add(int64(len(chunk)))
+	return nil
+}
+
+func (w *chunkWriter) Close() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	chunk := w.pending
+	w.pending = nil
+	return w.send(chunk)
+}
+
+// abort drops the issues not handed over yet.
+func (w *chunkWriter) Abort() error {
+	w.pending = nil
+	return nil
+}
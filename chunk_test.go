@@ -0,0 +1,79 @@
+package camembert
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOnChunk(t *testing.T) {
+	tests := []struct {
+		name       string
+		total      int
+		chunkSize  int
+		stream     bool
+		wantChunks []int
+	}{
+		{name: "default size", total: 2500, wantChunks: []int{1000, 1000, 500}},
+		{name: "smaller chunks", total: 250, chunkSize: 100, wantChunks: []int{100, 100, 50}},
+		{name: "exact", total: 200, chunkSize: 100, wantChunks: []int{100, 100}},
+		{name: "stream", total: 2500, chunkSize: 300, stream: true, wantChunks: []int{300, 300, 300, 300, 300, 300, 300, 300, 100}},
+		{name: "no issues", total: 0, wantChunks: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := (&fakeJira{total: tt.total}).start(t)
+			cfg.ChunkSize = tt.chunkSize
+			cfg.Stream = tt.stream
+			var chunks []int
+			seen := make(map[string]bool)
+			cfg.OnChunk = func(issues []JiraIssue) error {
+				chunks = append(chunks, len(issues))
+				for _, issue := range issues {
+					seen[issue.Key] = true
+				}
+				return nil
+			}
+			if _, err := Export(context.Background(), cfg); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(chunks, tt.wantChunks) {
+				t.Errorf("chunks of %v issues, want %v", chunks, tt.wantChunks)
+			}
+			if len(seen) != tt.total {
+				t.Errorf("handed %d distinct issues, want %d", len(seen), tt.total)
+			}
+		})
+	}
+}
+
+func TestOnChunkError(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		cfg := (&fakeJira{total: 250}).start(t)
+		cfg.ChunkSize = 100
+		cfg.Strict = strict
+		calls := 0
+		cfg.OnChunk = func(issues []JiraIssue) error {
+			calls++
+			if calls == 2 {
+				return errors.New("downstream unavailable")
+			}
+			return nil
+		}
+		result, err := Export(context.Background(), cfg)
+		if strict {
+			if err == nil || !strings.Contains(err.Error(), "downstream unavailable") {
+				t.Errorf("Strict: Export() error = %v, want the callback error", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if calls != 3 || result.Skipped != 100 {
+			t.Errorf("handed %d chunks, result %+v, want 3 chunks and the failed one skipped", calls, result)
+		}
+	}
+}
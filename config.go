@@ -0,0 +1,777 @@
+package camembert
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ExistingFilePolicy selects what happens when an output file already exists.
+type ExistingFilePolicy int
+
+const (
+	// ExistingError fails the export before anything is fetched, unless the
+	// output appends.
+	ExistingError ExistingFilePolicy = iota
+	// ExistingOverwrite replaces the file. For the DB output the whole
+	// database file is replaced, including tables camembert did not write.
+	ExistingOverwrite
+	// ExistingAppend adds to the file where the output supports it: rows are
+	// appended to the CSV file and upserted into the database. Other files
+	// are overwritten.
+	ExistingAppend
+)
+
+// FieldMapping selects a single Jira field for an output and names the column
+// it is written to. Field may be a dotted path into nested values, for example
+// "assignee.displayName". Column defaults to Field when empty.
+type FieldMapping struct {
+	Field  string
+	Column string
+}
+
+// CSVOutput configures the CSV file written by an export.
+type CSVOutput struct {
+	File string
+	// Writer, when set instead of File, receives the CSV output, for
+	// example an upload stream to cloud storage, so that nothing is written
+	// to disk. Rows are flushed to it after every batch, that is every page
+	// when streaming. Close is called once the export has succeeded, to
+	// finalize the upload. After a failure, CloseWithError is called instead
+	// when Writer has such a method, as io.PipeWriter does, so that the
+	// upload can be discarded; Close is called otherwise.
+	//
+	// Writes are synchronous: an upload slower than the fetch blocks the
+	// collection of pages. Fetched pages then wait in memory, unless
+	// MaxInFlight is set, in which case fetching is throttled as well.
+	Writer io.WriteCloser
+	// Fields selects the columns written after ID and Key. When empty the
+	// entire fields object is written as JSON to a single Fields column.
+	Fields []FieldMapping
+	// Flatten writes one column per top-level field found on any issue
+	// instead of a single Fields column. Issues lacking a field get an empty
+	// cell, so the column set does not depend on per-issue field visibility.
+	Flatten bool
+	// Append adds rows to an existing file, whatever the OnExisting policy.
+	// The header is only written when the file is new or empty, and the
+	// export fails when the header of an existing file differs.
+	Append bool
+	// SkipExisting, together with Append, skips issues whose key is already
+	// present in the file, which makes repeated incremental runs idempotent.
+	SkipExisting bool
+	// FieldNames names the columns of fields without an explicit Column,
+	// including the Flatten columns, after the field names instead of their
+	// IDs, for example "Story Points" rather than "customfield_10016".
+	FieldNames bool
+	// Newlines selects how newlines embedded in field values are written.
+	// CSV parsers handle quoted newlines, so they are kept by default, but
+	// many spreadsheet imports split such rows.
+	Newlines NewlinePolicy
+	// TrimTrailingSpace removes trailing whitespace from field values.
+	TrimTrailingSpace bool
+}
+
+// DBOutput configures the SQLite table written by an export.
+//
+// Issues are inserted in a single transaction committed once the export has
+// succeeded, so a failed or cancelled export leaves the database as it was.
+// With BatchCommit, every batch handed to the output, that is every page when
+// streaming, is committed on its own instead: a failed export then keeps the
+// batches committed before the failure and none of the batch in progress.
+//
+// Exports of the same process writing to the same File run one at a time. An
+// export locks the file when it opens the output, once its first page has
+// been fetched, and unlocks it when it ends, so another export waits there,
+// without fetching its other pages, until the first one is done.
+type DBOutput struct {
+	File  string
+	Table string
+	// Fields selects the columns stored after id and key. When empty the
+	// entire fields object is stored as JSON in a single fields column.
+	Fields []FieldMapping
+	// Columns renames the id, key and fields columns and sets their types.
+	Columns BaseColumns
+	// BatchCommit commits every batch as soon as it is written.
+	BatchCommit bool
+	// Append upserts issues into an existing database, whatever the
+	// OnExisting policy.
+	Append bool
+	// BusyTimeout is how long a write waits for a lock on File held by
+	// another process before failing with SQLITE_BUSY. Exports of the same
+	// process wait for each other instead, as described above. Zero keeps
+	// the 5 second default of the driver. Without BatchCommit, an export
+	// holds the lock until its last page is written.
+	BusyTimeout time.Duration
+	// Writer, when set instead of File, receives the database once the
+	// export has succeeded. The database, including the users, sprints and
+	// diagnostics tables, is built in memory and serialized at the end, so
+	// nothing is written to disk but the whole database is held in memory,
+	// twice while it is serialized. With the libsqlite3 build tag, this
+	// requires the sqlite_serialize build tag as well.
+	Writer io.Writer
+}
+
+// Config describes a single export run. Every configured output is written
+// from the same set of fetched issues.
+type Config struct {
+	JiraBaseURL string
+	Headers     map[string]string
+	ProjectKey  string
+	// IssueKeys, when set, exports exactly these issues instead of the
+	// issues of ProjectKey. Long lists are fetched with several queries.
+	IssueKeys []string
+
+	// UpdatedSince, when set, restricts the export of ProjectKey to the
+	// issues updated since then, for incremental exports. It is sent to the
+	// minute, in its own location, and Jira reads it in the time zone of
+	// the authenticated user.
+	UpdatedSince time.Time
+	// Watermark, when set instead of UpdatedSince, loads UpdatedSince from
+	// the store before the export and saves the start time of the export to
+	// it once the export has succeeded, so that every run picks up the
+	// issues updated since the previous one started, a minute earlier to
+	// make up for clock differences with Jira. Until a watermark is stored,
+	// every issue is exported. The watermark is not advanced when pages
+	// failed, in which case Export returns an error.
+	Watermark WatermarkStore
+	// ChangedFieldsOnly, together with UpdatedSince, fetches each updated
+	// issue with only the requested fields its changelog reports as changed
+	// since then, falling back to every requested field when the changelog
+	// is unavailable or truncated. This trims the payload of wide issues at
+	// the cost of one extra request per issue, and the outputs receive
+	// partial issues: it requires the DB output with Append, which merges
+	// them into the stored fields, while the CSV output and custom writers
+	// see the changed fields only.
+	ChangedFieldsOnly bool
+	// Consistent exports ProjectKey as of the start of the export, as far as
+	// Jira allows: only the issues created before the minute the export
+	// started in, in the time zone of the Jira user, are selected, sorted
+	// with ORDER BY created, so that issues created during the export do not
+	// shift the pages and cause duplicate or missing issues. JQL dates stop
+	// at the minute: the bound is exclusive, and the issues created within
+	// the minute the export started in are left to the next export. The
+	// start time is reported as StartedAt by the manifest. Jira has no
+	// snapshots: issues updated, moved or deleted during the export still
+	// drift, and are exported as they are when their page is fetched.
+	Consistent bool
+
+	// Endpoint selects the API issues are fetched from.
+	Endpoint Endpoint
+	// ServiceDeskID selects the service desk exported by EndpointServiceDesk.
+	ServiceDeskID string
+	// Fields lists the fields requested from Jira. By default every field
+	// is requested, or only those selected by the outputs when they all
+	// select some.
+	Fields []string
+	// FieldsPreset, when set, requests a predefined list of fields, along
+	// with Fields and the fields selected by the outputs, or every field
+	// with FieldsAll.
+	FieldsPreset FieldsPreset
+	// SafetyFields are always requested along with a narrowed field list so
+	// that exports stay usable downstream. They default to summary, status,
+	// issuetype, created and updated.
+	SafetyFields []string
+	// NoSafetyFields requests exactly the narrowed field list, for minimal
+	// payloads.
+	NoSafetyFields bool
+	// Expand lists the issue properties requested besides the fields, such
+	// as editmeta, operations or renderedFields. Each one is written to its
+	// own column by the CSV and DB outputs.
+	Expand []string
+	// APIVersion decides how version-specific fields, such as users and
+	// descriptions, are read by the JiraIssue accessors.
+	APIVersion APIVersion
+
+	CSV *CSVOutput
+	DB  *DBOutput
+	// Markdown writes the description and comments of every issue to a
+	// Markdown file of its own.
+	Markdown *MarkdownOutput
+	// Writers are custom outputs handed the same issues as CSV and DB.
+	Writers []Writer
+	// OnChunk, when set, is handed the written issues in chunks of
+	// ChunkSize, 1000 by default, the last chunk being smaller, for example
+	// to push them to a queue. It is called one chunk at a time and may keep
+	// the chunk. Its errors are logged and the issues of the chunk counted
+	// as skipped, unless Strict is set, in which case the export fails.
+	OnChunk   func(issues []JiraIssue) error
+	ChunkSize int
+	// Stages transform every batch of issues, in order, after the issue
+	// checks, duplicate removal and the collection of the users, sprints,
+	// epics and other references of the issues, and before the issues are
+	// written.
+	Stages []Stage
+	// ConcurrentWrites writes to every output in parallel, each one from its
+	// own goroutine, instead of one output after the other.
+	ConcurrentWrites bool
+
+	// Users exports the users referenced by the issues.
+	Users *UsersOutput
+	// Sprints exports the sprints the issues belong to.
+	Sprints *SprintsOutput
+	// ChildTables writes the labels and components of issues to tables of
+	// their own in the database of the DB output.
+	ChildTables *ChildTables
+	// Visibility exports the visibility restrictions of the comments and
+	// worklogs of issues, and counts the ones left out by Jira.
+	Visibility *VisibilityOutput
+	// FieldSnapshot records the fields found on the exported issues in the
+	// manifest and optionally in a table.
+	FieldSnapshot *FieldSnapshot
+	// FieldDefinitions exports the definitions of every field known to Jira.
+	FieldDefinitions *FieldsOutput
+	// Epics adds the key and summary of the epic of every issue.
+	Epics *EpicRollup
+	// Provenance adds source_url and fetched_at columns to the CSV and DB
+	// outputs, holding for every issue the URL of the request it was
+	// fetched with, credentials redacted, and the time of the response, so
+	// that each row can be traced back to its request.
+	Provenance bool
+	// Diagnostics records every page request, for debugging pagination.
+	Diagnostics *DiagnosticsOutput
+
+	// OnExisting selects what happens to output files that already exist.
+	// By default the export fails rather than replacing them.
+	OnExisting ExistingFilePolicy
+
+	// Checksums writes a .sha256 sidecar next to every output file.
+	Checksums bool
+	// ManifestFile, when set, receives a JSON description of the export run,
+	// including the checksums of the output files.
+	ManifestFile string
+	// ProfileFile, when set, receives a JSON profile of the columns selected
+	// by the Fields of the CSV and DB outputs: the number of nulls and of
+	// distinct values of each, the bounds of number and date columns and
+	// the most frequent values of text columns. Values are profiled as the
+	// issues are written, which costs an extra pass over every issue.
+	ProfileFile string
+
+	// RequestID correlates the log lines of an export with the caller's own
+	// traces. It defaults to the ID attached with WithRequestID.
+	RequestID string
+	// SendRequestID forwards the request ID to Jira as an X-Request-Id header.
+	SendRequestID bool
+
+	// Stream hands each page to the outputs as soon as it is fetched instead
+	// of holding every issue in memory until the last page has arrived. At
+	// most MaxInFlight pages are held at a time, so that the memory of the
+	// export does not grow with the project, besides the users, sprints,
+	// child table rows and visibility collected for their outputs.
+	Stream bool
+	// Ordered hands the pages to the outputs in the order of their offsets,
+	// whichever worker fetched them, and sorts the search with ORDER BY key,
+	// so that the issues are written sorted by key, or by creation with
+	// Consistent. The order is the one Jira applies server-side: pages are
+	// merged by offset, not resorted. Pages fetched ahead of one still in
+	// flight wait in memory, at most MaxInFlight of them when set. Ordered
+	// requires a ProjectKey.
+	Ordered bool
+	// MaxDuration caps the duration of the export. Once exceeded, fetching
+	// stops, the issues fetched so far are written and Export returns an
+	// error wrapping context.DeadlineExceeded. Zero means no limit.
+	MaxDuration time.Duration
+	// MaxTotalGuard, when set, fails the export after the first page when
+	// Jira reports more matching issues than this, before anything is
+	// written, so that a mistyped query does not run for hours against the
+	// instance. Raise or clear it to export such a result on purpose.
+	MaxTotalGuard int
+	// MaxInFlight caps the number of pages fetched or being fetched but not
+	// yet written, bounding the memory held by an export. When streaming, a
+	// slow output then throttles fetching, and offsets are only handed to
+	// the workers as slots free up. Zero means twice the number of workers
+	// when streaming, and no limit otherwise.
+	MaxInFlight int
+	// AutoConcurrency tunes the number of page requests sent in parallel,
+	// starting with one and adding one as long as throughput improves, up
+	// to the number of workers, and halving it on every 429 response, after
+	// which it stays below the value that was rate limited. The value
+	// settled on is reported in ExportResult.Concurrency.
+	AutoConcurrency bool
+	// RampUp, when set, starts the workers one at a time, each RampUp after
+	// the previous one, instead of all at once. This smooths the burst of
+	// requests at the start of an export. Zero starts every worker at once.
+	RampUp time.Duration
+
+	// MaxRetries is the number of times a page request failing with a
+	// network error, 429 Too Many Requests or a 500, 502, 503 or 504 status
+	// is sent again. Other failures, such as an invalid URL or a response
+	// that is not JSON, are not retried.
+	MaxRetries int
+	// RetryBackoff is the delay before the first retry, doubled with every
+	// attempt. It defaults to one second. A Retry-After header sent by Jira
+	// takes precedence.
+	RetryBackoff time.Duration
+	// OnRetry, when set, is called before every retry of a page request.
+	// OnRateLimit, when set, is called for every 429 response with the delay
+	// requested by Jira, zero when none. Both are called one event at a time
+	// from a goroutine of their own, so a slow callback delays later events
+	// but never the export, and every event is delivered before Export
+	// returns.
+	OnRetry     func(attempt int, startAt int, err error)
+	OnRateLimit func(retryAfter time.Duration)
+
+	// HTTPClient sends the requests of the export, http.Client{} by default.
+	HTTPClient *http.Client
+	// Recorder, when set, captures every request sent by the export.
+	Recorder *RequestRecorder
+	// RequireFieldNames aborts the export when the field names used by
+	// CSVOutput.FieldNames cannot be fetched. By default a warning is logged
+	// and columns are named after the field IDs.
+	RequireFieldNames bool
+
+	// UnknownFields controls how requested fields unknown to Jira are
+	// handled, checking them against the field endpoint before the first
+	// search unless left to UnknownFieldsKeep.
+	UnknownFields UnknownFieldPolicy
+	// PreserveFieldOrder writes the fields JSON of the CSV and DB outputs
+	// with object keys in the order Jira returned them, and unchanged values
+	// as Jira encoded them, instead of with sorted keys. It applies to the
+	// search endpoint, not to EndpointServiceDesk. The fields of every issue
+	// are then held twice in memory, decoded and as received, and re-read
+	// when written, which makes writing noticeably slower.
+	PreserveFieldOrder bool
+	// MissingFields controls how fields returned for only some of the issues
+	// are handled.
+	MissingFields MissingFieldPolicy
+
+	// EmptyKey selects how issues returned without a key are handled. Such
+	// issues usually point at an unexpected endpoint or missing permissions.
+	EmptyKey Policy
+	// EmptyID selects how issues returned without an ID are handled. The ID
+	// is the primary key of the DB output, where such issues would replace
+	// each other. With PolicyWarn, the default, the key of the issue is used
+	// as its ID.
+	EmptyID Policy
+	// Duplicates selects how issues returned more than once are handled.
+	// By default the first copy is kept.
+	Duplicates DuplicatePolicy
+	// Schemas validates the fields of every issue before it is written.
+	Schemas []SchemaCheck
+
+	// Strict turns validation warnings into errors, and makes errors
+	// returned by OnChunk fail the export.
+	Strict bool
+
+	// pagesOnly is set by Paginate, which hands pages over instead of
+	// writing outputs.
+	pagesOnly bool
+	// createdUntil is the start of the export with Consistent.
+	createdUntil time.Time
+	// jqlZone is the time zone of the Jira user, in which JQL dates are
+	// read.
+	jqlZone *time.Location
+}
+
+// withoutOutputs returns a copy of c for Paginate, with no outputs.
+func (c Config) withoutOutputs() Config {
+	c.CSV, c.DB, c.Markdown, c.Writers, c.OnChunk = nil, nil, nil, nil, nil
+	c.Users, c.Sprints, c.Epics, c.Visibility, c.ChildTables = nil, nil, nil, nil, nil
+	c.FieldDefinitions, c.FieldSnapshot, c.Diagnostics = nil, nil, nil
+	c.ManifestFile, c.ProfileFile, c.Checksums = "", "", false
+	c.pagesOnly = true
+	return c
+}
+
+// Validate reports configuration errors before any request is sent. Problems
+// that do not prevent an export, such as missing authentication, are logged
+// as warnings unless Strict is set.
+func (c Config) Validate() error {
+	return c.validate(log.Default())
+}
+
+func (c Config) validate(logger *log.Logger) error {
+	if c.JiraBaseURL == "" {
+		return errors.New("JiraBaseURL is required")
+	}
+	if _, err := url.Parse(c.JiraBaseURL); err != nil {
+		return fmt.Errorf("invalid JiraBaseURL: %w", err)
+	}
+	switch c.Endpoint {
+	case EndpointSearch:
+		if c.ProjectKey == "" && len(c.IssueKeys) == 0 {
+			return errors.New("ProjectKey or IssueKeys is required")
+		}
+		if c.ProjectKey != "" && len(c.IssueKeys) > 0 {
+			return errors.New("ProjectKey and IssueKeys are mutually exclusive")
+		}
+		if !c.UpdatedSince.IsZero() && len(c.IssueKeys) > 0 {
+			return errors.New("UpdatedSince is not supported with IssueKeys")
+		}
+		if c.Watermark != nil && len(c.IssueKeys) > 0 {
+			return errors.New("Watermark is not supported with IssueKeys")
+		}
+		if c.Watermark != nil && !c.UpdatedSince.IsZero() {
+			return errors.New("Watermark and UpdatedSince are mutually exclusive")
+		}
+		if c.ChangedFieldsOnly && c.UpdatedSince.IsZero() && c.Watermark == nil {
+			return errors.New("ChangedFieldsOnly requires UpdatedSince or a Watermark")
+		}
+		if c.ChangedFieldsOnly && (c.DB == nil || !c.dbAppends()) {
+			return errors.New("ChangedFieldsOnly requires the DB output with Append to merge the changed fields into")
+		}
+	case EndpointServiceDesk:
+		if c.ServiceDeskID == "" {
+			return errors.New("ServiceDeskID is required by EndpointServiceDesk")
+		}
+		if len(c.Expand) > 0 {
+			return errors.New("Expand is not supported by EndpointServiceDesk")
+		}
+		if len(c.IssueKeys) > 0 {
+			return errors.New("IssueKeys is not supported by EndpointServiceDesk")
+		}
+		if !c.UpdatedSince.IsZero() {
+			return errors.New("UpdatedSince is not supported by EndpointServiceDesk")
+		}
+		if c.Watermark != nil {
+			return errors.New("Watermark is not supported by EndpointServiceDesk")
+		}
+	default:
+		return fmt.Errorf("unknown Endpoint %d", c.Endpoint)
+	}
+	switch c.FieldsPreset {
+	case FieldsPresetNone, FieldsMinimal, FieldsReporting, FieldsAll:
+	default:
+		return fmt.Errorf("unknown FieldsPreset %d", c.FieldsPreset)
+	}
+	switch c.APIVersion {
+	case APIVersionAuto, APIVersion2, APIVersion3:
+	default:
+		return fmt.Errorf("unsupported APIVersion %d", c.APIVersion)
+	}
+	if c.CSV == nil && c.DB == nil && c.Markdown == nil && len(c.Writers) == 0 && c.OnChunk == nil && !c.pagesOnly {
+		return errors.New("no output configured")
+	}
+	if c.Markdown != nil && c.Markdown.Dir == "" {
+		return errors.New("Markdown output requires a Dir")
+	}
+	if c.CSV != nil {
+		if (c.CSV.File == "") == (c.CSV.Writer == nil) {
+			return errors.New("CSV output requires either a File or a Writer")
+		}
+		if c.CSV.Writer != nil && c.csvAppends() {
+			return errors.New("CSV output: a Writer cannot be appended to")
+		}
+		if err := validateMappings(c.CSV.Fields); err != nil {
+			return fmt.Errorf("CSV output: %w", err)
+		}
+		if c.CSV.Flatten && len(c.CSV.Fields) > 0 {
+			return errors.New("CSV output: Flatten and Fields are mutually exclusive")
+		}
+		if c.CSV.Flatten && c.csvAppends() {
+			return errors.New("CSV output: Flatten columns depend on the issues and cannot be appended to")
+		}
+		if c.CSV.SkipExisting && !c.csvAppends() {
+			return errors.New("CSV output: SkipExisting requires appending")
+		}
+	}
+	if c.DB != nil {
+		if (c.DB.File == "") == (c.DB.Writer == nil) || c.DB.Table == "" {
+			return errors.New("DB output requires either a File or a Writer, and a Table")
+		}
+		if c.DB.Writer != nil && c.dbAppends() {
+			return errors.New("DB output: a Writer cannot be appended to")
+		}
+		if err := validateMappings(c.DB.Fields); err != nil {
+			return fmt.Errorf("DB output: %w", err)
+		}
+		if err := c.DB.Columns.validate(); err != nil {
+			return fmt.Errorf("DB output: %w", err)
+		}
+	}
+	if c.Sprints != nil {
+		if c.Sprints.CSVFile == "" && c.Sprints.Table == "" {
+			return errors.New("sprints output requires a CSVFile or a Table")
+		}
+		if c.Sprints.Table != "" && c.DB == nil {
+			return errors.New("sprints output table requires a DB output")
+		}
+	}
+	if c.Diagnostics != nil {
+		if c.Diagnostics.CSVFile == "" && c.Diagnostics.Table == "" {
+			return errors.New("diagnostics output requires a CSVFile or a Table")
+		}
+		if c.Diagnostics.Table != "" && c.DB == nil {
+			return errors.New("diagnostics output table requires a DB output")
+		}
+	}
+	if c.Stream {
+		if c.CSV != nil && c.CSV.Flatten {
+			return errors.New("CSV output: Flatten needs every issue and cannot be streamed")
+		}
+		if c.MissingFields != MissingFieldsIgnore {
+			return errors.New("MissingFields needs every issue and cannot be streamed")
+		}
+		if c.Duplicates == DuplicatesKeepLast {
+			return errors.New("DuplicatesKeepLast needs every issue and cannot be streamed")
+		}
+	}
+	if _, err := compileSchemas(c.Schemas); err != nil {
+		return err
+	}
+	if c.MaxRetries < 0 {
+		return errors.New("MaxRetries cannot be negative")
+	}
+	if c.MaxDuration < 0 {
+		return errors.New("MaxDuration cannot be negative")
+	}
+	if c.MaxInFlight < 0 {
+		return errors.New("MaxInFlight must not be negative")
+	}
+	if c.RampUp < 0 {
+		return errors.New("RampUp cannot be negative")
+	}
+	if c.Ordered && (c.Endpoint != EndpointSearch || c.ProjectKey == "") {
+		return errors.New("Ordered requires EndpointSearch with a ProjectKey")
+	}
+	if c.Consistent && (c.Endpoint != EndpointSearch || c.ProjectKey == "") {
+		return errors.New("Consistent requires EndpointSearch with a ProjectKey")
+	}
+	if c.MaxTotalGuard < 0 {
+		return errors.New("MaxTotalGuard cannot be negative")
+	}
+	if c.ChunkSize < 0 {
+		return errors.New("ChunkSize cannot be negative")
+	}
+	if c.Users != nil {
+		if c.Users.CSVFile == "" && c.Users.Table == "" {
+			return errors.New("users output requires a CSVFile or a Table")
+		}
+		if c.Users.Table != "" && c.DB == nil {
+			return errors.New("users output table requires a DB output")
+		}
+	}
+	if c.ChildTables != nil {
+		if c.ChildTables.Labels == "" && c.ChildTables.Components == "" {
+			return errors.New("child tables require a Labels or a Components table")
+		}
+		if c.DB == nil {
+			return errors.New("child tables require a DB output")
+		}
+	}
+	if c.Visibility != nil {
+		if c.Visibility.CSVFile == "" && c.Visibility.Table == "" {
+			return errors.New("visibility output requires a CSVFile or a Table")
+		}
+		if c.Visibility.Table != "" && c.DB == nil {
+			return errors.New("visibility output table requires a DB output")
+		}
+	}
+	if c.FieldSnapshot != nil {
+		if c.ManifestFile == "" && c.FieldSnapshot.Table == "" {
+			return errors.New("field snapshot requires a ManifestFile or a Table")
+		}
+		if c.FieldSnapshot.Table != "" && c.DB == nil {
+			return errors.New("field snapshot table requires a DB output")
+		}
+	}
+	if c.ProfileFile != "" && len(c.profileMappings()) == 0 {
+		return errors.New("ProfileFile requires CSV or DB output Fields")
+	}
+	if c.FieldDefinitions != nil {
+		if c.FieldDefinitions.CSVFile == "" && c.FieldDefinitions.Table == "" {
+			return errors.New("field definitions output requires a CSVFile or a Table")
+		}
+		if c.FieldDefinitions.Table != "" && c.DB == nil {
+			return errors.New("field definitions output table requires a DB output")
+		}
+	}
+
+	if err := c.checkExistingFiles(); err != nil {
+		return err
+	}
+
+	if !c.hasAuthentication() {
+		if err := c.warn(logger, "no authentication configured: set an Authorization or Cookie header, otherwise Jira usually returns no issues or a login page"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c Config) csvAppends() bool {
+	return c.CSV.Append || c.OnExisting == ExistingAppend
+}
+
+func (c Config) dbAppends() bool {
+	return c.DB.Append || c.OnExisting == ExistingAppend
+}
+
+// checkExistingFiles fails when an output file that is neither appended to
+// nor allowed to be overwritten already exists.
+func (c Config) checkExistingFiles() error {
+	if c.OnExisting != ExistingError {
+		return nil
+	}
+	files := c.outputFiles()
+	if c.ManifestFile != "" {
+		files = append(files, c.ManifestFile)
+	}
+	for _, path := range files {
+		if c.CSV != nil && path == c.CSV.File && c.csvAppends() {
+			continue
+		}
+		if c.DB != nil && path == c.DB.File && c.dbAppends() {
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("output file %s already exists, set OnExisting to overwrite or append to it", path)
+		}
+	}
+	if c.Markdown != nil {
+		entries, _ := os.ReadDir(c.Markdown.Dir)
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".md") {
+				return fmt.Errorf("Markdown file %s already exists, set OnExisting to overwrite the files of %s", filepath.Join(c.Markdown.Dir, entry.Name()), c.Markdown.Dir)
+			}
+		}
+	}
+	return nil
+}
+
+// warn logs msg, or returns it as an error in strict mode.
+func (c Config) warn(logger *log.Logger, msg string) error {
+	if c.Strict {
+		return errors.New(msg)
+	}
+	logger.Printf("Warning: %s", msg)
+	return nil
+}
+
+func (c Config) hasAuthentication() bool {
+	for name, value := range c.Headers {
+		if value == "" {
+			continue
+		}
+		if strings.EqualFold(name, "Authorization") || strings.EqualFold(name, "Cookie") {
+			return true
+		}
+	}
+	return false
+}
+
+func validateMappings(mappings []FieldMapping) error {
+	columns := make(map[string]bool)
+	for _, m := range mappings {
+		if m.Field == "" {
+			return errors.New("field mapping without a Field")
+		}
+		if columns[m.column()] {
+			return fmt.Errorf("duplicate column %q", m.column())
+		}
+		columns[m.column()] = true
+	}
+	return nil
+}
+
+func (m FieldMapping) column() string {
+	if m.Column != "" {
+		return m.Column
+	}
+	return m.Field
+}
+
+// defaultSafetyFields are merged into narrowed field requests unless
+// Config.SafetyFields says otherwise.
+var defaultSafetyFields = []string{"summary", "status", "issuetype", "created", "updated"}
+
+// fetchFields returns the value sent as the fields query parameter. Without
+// Config.Fields or a preset, all fields are requested unless every output
+// selects its own subset, in which case only the top-level fields those
+// subsets reference are fetched. Narrowed requests always include the safety
+// fields.
+func (c Config) fetchFields() string {
+	if c.FieldsPreset == FieldsAll {
+		return "*all"
+	}
+	requested := append(append([]string(nil), presetFields[c.FieldsPreset]...), c.Fields...)
+
+	var outputs [][]FieldMapping
+	if c.CSV != nil {
+		outputs = append(outputs, c.CSV.Fields)
+	}
+	if c.DB != nil {
+		outputs = append(outputs, c.DB.Fields)
+	}
+	for range c.Writers {
+		outputs = append(outputs, nil)
+	}
+	if c.OnChunk != nil || c.pagesOnly {
+		outputs = append(outputs, nil)
+	}
+	if c.Users != nil {
+		var mappings []FieldMapping
+		for _, name := range userFields {
+			mappings = append(mappings, FieldMapping{Field: name})
+		}
+		outputs = append(outputs, mappings)
+	}
+	if c.Sprints != nil && c.Sprints.Field != "" {
+		outputs = append(outputs, []FieldMapping{{Field: c.Sprints.Field}})
+	}
+	if c.Epics != nil {
+		outputs = append(outputs, []FieldMapping{{Field: c.Epics.field()}})
+	}
+	if c.Markdown != nil {
+		var mappings []FieldMapping
+		for _, name := range markdownFields {
+			mappings = append(mappings, FieldMapping{Field: name})
+		}
+		outputs = append(outputs, mappings)
+	}
+	if c.ChildTables != nil {
+		var mappings []FieldMapping
+		for _, name := range childFields {
+			mappings = append(mappings, FieldMapping{Field: name})
+		}
+		outputs = append(outputs, mappings)
+	}
+	if c.Visibility != nil {
+		var mappings []FieldMapping
+		for _, f := range visibilityFields {
+			mappings = append(mappings, FieldMapping{Field: f.field})
+		}
+		outputs = append(outputs, mappings)
+	}
+
+	var fields []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			fields = append(fields, name)
+		}
+	}
+	for _, name := range requested {
+		add(name)
+	}
+	for _, mappings := range outputs {
+		if len(mappings) == 0 && len(requested) == 0 {
+			return "*all"
+		}
+		for _, m := range mappings {
+			name, _, _ := strings.Cut(m.Field, ".")
+			add(name)
+		}
+	}
+	if len(fields) == 0 {
+		return "*all"
+	}
+
+	if !c.NoSafetyFields {
+		safety := c.SafetyFields
+		if safety == nil {
+			safety = defaultSafetyFields
+		}
+		for _, name := range safety {
+			add(name)
+		}
+	}
+	return strings.Join(fields, ",")
+}
@@ -0,0 +1,297 @@
+package camembert
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// existingCSVKeys streams the Key column of a previously written CSV file.
+// A missing file has no keys.
+func existingCSVKeys(path string) (map[string]bool, error) {
+	keys := make(map[string]bool)
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return keys, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return keys, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	keyColumn := slices.Index(header, "Key")
+	if keyColumn < 0 {
+		return nil, fmt.Errorf("no Key column in %s", path)
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return keys, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if keyColumn < len(record) {
+			keys[record[keyColumn]] = true
+		}
+	}
+}
+
+// existingCSVHeader returns the header of a previously written CSV file, or
+// nil when the file is missing or empty.
+func existingCSVHeader(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	return header, err
+}
+
+// NewlinePolicy selects how newlines embedded in CSV field values are written.
+type NewlinePolicy int
+
+const (
+	// NewlinesKeep writes newlines as-is, within quoted cells.
+	NewlinesKeep NewlinePolicy = iota
+	// NewlinesEscape replaces newlines with a literal \n.
+	NewlinesEscape
+	// NewlinesSpace replaces newlines with spaces.
+	NewlinesSpace
+)
+
+// csvWriter writes issues to a CSV file as they are handed to it. In Flatten
+// mode the columns depend on every issue, so rows are held until close.
+type csvWriter struct {
+	e        *exporter
+	output   CSVOutput
+	out      io.WriteCloser
+	writer   *csv.Writer
+	mappings []FieldMapping
+	existing map[string]bool
+	pending  []JiraIssue
+	header   bool
+	skipped  int
+}
+
+func (e *exporter) newCSVWriter(output CSVOutput) (*csvWriter, error) {
+	output.Append = e.cfg.csvAppends()
+	w := &csvWriter{e: e, output: output, mappings: output.Fields}
+	if output.Writer != nil {
+		e.logger.Println("Saving issues to a CSV stream")
+		e.csvStream = nil
+		w.out = output.Writer
+		w.writer = csv.NewWriter(output.Writer)
+		w.header = true
+		return w, nil
+	}
+	e.logger.Printf("Saving issues to CSV file: %s", output.File)
+
+	if output.SkipExisting {
+		keys, err := existingCSVKeys(output.File)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read existing keys: %w", err)
+		}
+		w.existing = keys
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if output.Append {
+		// Rows appended under another header would be misaligned
+		header, err := existingCSVHeader(output.File)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read existing header: %w", err)
+		}
+		if header != nil && !slices.Equal(header, w.headers()) {
+			return nil, fmt.Errorf("the header of %s, %s, differs from the columns written, %s", output.File, strings.Join(header, ","), strings.Join(w.headers(), ","))
+		}
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(output.File, flags, 0o666)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	w.out = file
+	w.writer = csv.NewWriter(file)
+	w.header = info.Size() == 0
+	return w, nil
+}
+
+func (w *csvWriter) WriteIssues(ctx context.Context, issues []JiraIssue) error {
+	if w.output.Flatten {
+		w.pending = append(w.pending, issues...)
+		return nil
+	}
+	return w.writeRecords(issues)
+}
+
+func (w *csvWriter) writeRecords(issues []JiraIssue) error {
+	// Write CSV headers
+	if w.header {
+		if err := w.writer.Write(w.headers()); err != nil {
+			return fmt.Errorf("failed to write CSV headers: %w", err)
+		}
+		w.header = false
+	}
+
+	// Write issue data
+	for _, issue := range issues {
+		if w.existing[issue.Key] {
+			w.skipped++
+			w.e.stats.skipped.Add(1)
+			continue
+		}
+		record := []string{issue.ID, issue.Key}
+		if len(w.mappings) == 0 {
+			record = append(record, fieldsJSON(issue))
+		}
+		for _, m := range w.mappings {
+			record = append(record, w.cell(fieldValue(issue.Fields, m.Field)))
+		}
+		for _, name := range w.e.cfg.Expand {
+			record = append(record, string(issue.Expanded[name]))
+		}
+		if w.e.cfg.Epics != nil {
+			record = append(record, issue.EpicKey, w.cell(issue.EpicSummary))
+		}
+		if w.e.cfg.Provenance {
+			record = append(record, issue.SourceURL, fetchedAt(issue))
+		}
+		if err := w.writer.Write(record); err != nil {
+			return fmt.Errorf("failed to write data in CSV file: %w", err)
+		}
+	}
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// FieldsFormat asks for the encoded fields when they are written to a single
+// Fields column.
+func (w *csvWriter) FieldsFormat() FieldsFormat {
+	if len(w.output.Fields) == 0 && !w.output.Flatten {
+		return FieldsEncoded
+	}
+	return FieldsDecoded
+}
+
+// cell normalizes a field value according to the output options.
+func (w *csvWriter) cell(value string) string {
+	if w.output.TrimTrailingSpace {
+		value = strings.TrimRightFunc(value, unicode.IsSpace)
+	}
+	switch w.output.Newlines {
+	case NewlinesEscape:
+		value = strings.ReplaceAll(strings.ReplaceAll(value, "\r\n", "\n"), "\n", `\n`)
+	case NewlinesSpace:
+		value = strings.ReplaceAll(strings.ReplaceAll(value, "\r\n", "\n"), "\n", " ")
+	}
+	return value
+}
+
+// headers returns the header of the file.
+func (w *csvWriter) headers() []string {
+	headers := []string{"ID", "Key"}
+	if len(w.mappings) == 0 {
+		headers = append(headers, "Fields")
+	}
+	for _, m := range w.mappings {
+		headers = append(headers, w.column(m))
+	}
+	headers = append(headers, w.e.cfg.Expand...)
+	if w.e.cfg.Epics != nil {
+		headers = append(headers, epicColumns...)
+	}
+	if w.e.cfg.Provenance {
+		headers = append(headers, provenanceColumns...)
+	}
+	return headers
+}
+
+// column returns the header of the column m is written to.
+func (w *csvWriter) column(m FieldMapping) string {
+	if m.Column == "" && w.output.FieldNames {
+		if name, ok := w.e.fieldNames[m.Field]; ok {
+			return name
+		}
+	}
+	return m.column()
+}
+
+func (w *csvWriter) Close() error {
+	if w.output.Flatten {
+		for _, name := range fieldNames(w.pending) {
+			w.mappings = append(w.mappings, FieldMapping{Field: name})
+		}
+	}
+	// Write the held rows, or at least the header of an empty export
+	if err := w.writeRecords(w.pending); err != nil {
+		w.closeOutput(err)
+		return err
+	}
+	if w.output.SkipExisting {
+		w.e.logger.Printf("Skipped %d issues already present in %s", w.skipped, w.output.File)
+	}
+	return w.closeOutput(nil)
+}
+
+// abort keeps the rows written so far and drops the ones held back.
+func (w *csvWriter) Abort() error {
+	w.writer.Flush()
+	return w.closeOutput(errors.New("export failed"))
+}
+
+// closeOutput closes the file or CSVOutput.Writer, reporting err, if any, as
+// the reason of a failed export.
+func (w *csvWriter) closeOutput(err error) error {
+	return closeWithError(w.out, err)
+}
+
+// closeWithError closes out. When err reports a failed export, it is handed
+// to the CloseWithError method of out if it has one.
+func closeWithError(out io.Closer, err error) error {
+	if closer, ok := out.(interface{ CloseWithError(error) error }); ok && err != nil {
+		return closer.CloseWithError(err)
+	}
+	return out.Close()
+}
+
+// discardCSVStream closes CSVOutput.Writer with err when the export failed
+// before the CSV writer was opened.
+func (e *exporter) discardCSVStream(err error) {
+	if e.csvStream != nil {
+		closeWithError(e.csvStream, err)
+		e.csvStream = nil
+	}
+}
@@ -0,0 +1,112 @@
+package camembert
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCSVAppendChecksHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		fields   []FieldMapping
+		wantErr  string
+		wantRows int
+	}{
+		{name: "missing file", fields: []FieldMapping{{Field: "summary"}}, wantRows: 3},
+		{name: "empty file", existing: "", fields: []FieldMapping{{Field: "summary"}}, wantRows: 3},
+		{name: "same header", existing: "ID,Key,summary\n1,P-9,old\n", fields: []FieldMapping{{Field: "summary"}}, wantRows: 4},
+		{name: "other fields", existing: "ID,Key,summary\n1,P-9,old\n", fields: []FieldMapping{{Field: "status.name", Column: "status"}}, wantErr: "differs from the columns written"},
+		{name: "fields blob", existing: "ID,Key,summary\n1,P-9,old\n", wantErr: "differs from the columns written"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "issues.csv")
+			if tt.name != "missing file" {
+				if err := os.WriteFile(file, []byte(tt.existing), 0o666); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cfg := (&fakeJira{total: 3}).start(t)
+			cfg.CSV = &CSVOutput{File: file, Fields: tt.fields, Append: true}
+			_, err := Export(context.Background(), cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Export() error = %v, want %q", err, tt.wantErr)
+				}
+				data, _ := os.ReadFile(file)
+				if string(data) != tt.existing {
+					t.Errorf("file changed to %q", data)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+			data, _ := os.ReadFile(file)
+			lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+			if lines[0] != "ID,Key,summary" || len(lines) != tt.wantRows+1 {
+				t.Errorf("file = %q, want a single header and %d rows", data, tt.wantRows)
+			}
+		})
+	}
+}
+
+func TestCSVFlattenCannotAppend(t *testing.T) {
+	for _, cfg := range []Config{
+		{CSV: &CSVOutput{File: "issues.csv", Flatten: true, Append: true}},
+		{CSV: &CSVOutput{File: "issues.csv", Flatten: true}, OnExisting: ExistingAppend},
+	} {
+		cfg.JiraBaseURL, cfg.ProjectKey = "http://jira.example.com/rest/api/2/search", "P"
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "cannot be appended to") {
+			t.Errorf("Validate() error = %v, want Flatten rejected with appending", err)
+		}
+	}
+}
+
+func TestCSVNewlines(t *testing.T) {
+	tests := []struct {
+		name     string
+		newlines NewlinePolicy
+		trim     bool
+		want     string
+	}{
+		// The CSV reader reads the \r\n kept in quoted cells as \n.
+		{name: "keep", newlines: NewlinesKeep, want: "one\ntwo  \nthree \t"},
+		{name: "escape", newlines: NewlinesEscape, want: `one\ntwo  \nthree ` + "\t"},
+		{name: "space", newlines: NewlinesSpace, want: "one two   three \t"},
+		{name: "trim", newlines: NewlinesKeep, trim: true, want: "one\ntwo  \nthree"},
+		{name: "escape and trim", newlines: NewlinesEscape, trim: true, want: `one\ntwo  \nthree`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "issues.csv")
+			cfg := (&fakeJira{total: 1, fields: map[string]json.RawMessage{"description": json.RawMessage(`"one\r\ntwo  \nthree \t"`)}}).start(t)
+			cfg.CSV = &CSVOutput{File: file, Fields: []FieldMapping{{Field: "description"}}, Newlines: tt.newlines, TrimTrailingSpace: tt.trim}
+			if _, err := Export(context.Background(), cfg); err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := os.Open(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			records, err := csv.NewReader(f).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 2 {
+				t.Fatalf("CSV = %q, want a header and one row", records)
+			}
+			if got := records[1][2]; got != tt.want {
+				t.Errorf("description = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,447 @@
+package camembert
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// quoteIdent quotes name for use as an SQLite identifier.
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+var (
+	identPattern    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	typeNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*( [A-Za-z_][A-Za-z0-9_]*)*(\([0-9]+(, ?[0-9]+)?\))?$`)
+)
+
+// BaseColumns names and types the id, key and fields columns of the DB
+// output. Names must be plain identifiers and types SQLite type names such as
+// INTEGER, JSON or VARCHAR(32). Empty values keep the defaults: columns
+// named id, key and fields, of type TEXT.
+//
+// Diff and ExportTableToCSV take the BaseColumns of the tables they read.
+type BaseColumns struct {
+	ID         string
+	Key        string
+	Fields     string
+	IDType     string
+	KeyType    string
+	FieldsType string
+}
+
+func (c BaseColumns) validate() error {
+	seen := make(map[string]bool)
+	for _, name := range []string{c.id(), c.key(), c.fields()} {
+		if !identPattern.MatchString(name) {
+			return fmt.Errorf("invalid column name %q", name)
+		}
+		if seen[strings.ToLower(name)] {
+			return fmt.Errorf("duplicate column %q", name)
+		}
+		seen[strings.ToLower(name)] = true
+	}
+	for _, typ := range []string{c.IDType, c.KeyType, c.FieldsType} {
+		if typ != "" && !typeNamePattern.MatchString(typ) {
+			return fmt.Errorf("invalid column type %q", typ)
+		}
+	}
+	return nil
+}
+
+func (c BaseColumns) id() string     { return orDefault(c.ID, "id") }
+func (c BaseColumns) key() string    { return orDefault(c.Key, "key") }
+func (c BaseColumns) fields() string { return orDefault(c.Fields, "fields") }
+
+// columnType returns typ, or TEXT when it is empty.
+func columnType(typ string) string {
+	return orDefault(typ, "TEXT")
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// dbWriter inserts issues into an SQLite table as they are handed to it.
+// Everything is written in a single transaction committed by close, unless
+// BatchCommit is set, in which case every batch is committed on its own.
+type dbWriter struct {
+	e         *exporter
+	output    DBOutput
+	expand    []string
+	epics     bool
+	db        *sql.DB
+	tx        *sql.Tx
+	insert    *sql.Stmt
+	insertSQL string
+
+	// partial is set when issues only hold their changed fields, in which
+	// case absent fields are stored as NULL and keep their stored value.
+	partial bool
+}
+
+func (e *exporter) newDBWriter(output DBOutput) (*dbWriter, error) {
+	if output.Writer != nil {
+		e.logger.Printf("Saving issues to an in-memory database in table %s.", output.Table)
+	} else {
+		e.logger.Printf("Saving issues to DB file %s in table %s.", output.File, output.Table)
+	}
+
+	db, err := e.openDB(output.File)
+	if err != nil {
+		return nil, err
+	}
+	// The file is replaced once locked, before the database is first used
+	if output.Writer == nil && !e.cfg.dbAppends() {
+		if err := os.Remove(output.File); err != nil && !errors.Is(err, os.ErrNotExist) {
+			e.releaseDB(db)
+			return nil, fmt.Errorf("failed to replace database file: %w", err)
+		}
+	}
+
+	base := output.Columns
+	id, fields := quoteIdent(base.id()), quoteIdent(base.fields())
+	columns := []string{id, quoteIdent(base.key())}
+	if len(output.Fields) == 0 {
+		columns = append(columns, fields)
+	}
+	for _, m := range output.Fields {
+		columns = append(columns, quoteIdent(m.column()))
+	}
+	for _, name := range e.cfg.Expand {
+		columns = append(columns, quoteIdent(name))
+	}
+	if e.cfg.Epics != nil {
+		columns = append(columns, epicColumns...)
+	}
+	if e.cfg.Provenance {
+		columns = append(columns, provenanceColumns...)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	insertSQL := fmt.Sprintf(`INSERT OR REPLACE INTO %s (%s) VALUES (%s)`, output.Table, strings.Join(columns, ", "), placeholders)
+	if e.cfg.ChangedFieldsOnly {
+		// Merge partial issues into the stored rows
+		var updates []string
+		for _, column := range columns[1:] {
+			switch column {
+			case fields:
+				updates = append(updates, fmt.Sprintf("%s = json_patch(coalesce(%s, '{}'), excluded.%s)", column, column, column))
+			default:
+				updates = append(updates, fmt.Sprintf("%s = coalesce(excluded.%s, %s)", column, column, column))
+			}
+		}
+		insertSQL = fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s) DO UPDATE SET %s`, output.Table, strings.Join(columns, ", "), placeholders, id, strings.Join(updates, ", "))
+	}
+	w := &dbWriter{
+		e:         e,
+		output:    output,
+		expand:    e.cfg.Expand,
+		epics:     e.cfg.Epics != nil,
+		partial:   e.cfg.ChangedFieldsOnly,
+		db:        db,
+		insertSQL: insertSQL,
+	}
+	if err := w.begin(); err != nil {
+		w.closeDB()
+		return nil, err
+	}
+
+	// Create table if it doesn't exist
+	columnDefs := []string{
+		id + " " + columnType(base.IDType) + " PRIMARY KEY",
+		columns[1] + " " + columnType(base.KeyType),
+	}
+	for _, column := range columns[2:] {
+		typ := "TEXT"
+		if column == fields {
+			typ = columnType(base.FieldsType)
+		}
+		columnDefs = append(columnDefs, column+" "+typ)
+	}
+	createTableSQL := fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s (
+		%s
+	);`, output.Table, strings.Join(columnDefs, ",\n\t\t"))
+	if _, err := w.tx.Exec(createTableSQL); err != nil {
+		w.Abort()
+		return nil, fmt.Errorf("failed to create the table in the database: %w", err)
+	}
+	if err := w.prepare(); err != nil {
+		w.Abort()
+		return nil, err
+	}
+	return w, nil
+}
+
+// FieldsFormat asks for the encoded fields when they are stored in a single
+// fields column.
+func (w *dbWriter) FieldsFormat() FieldsFormat {
+	if len(w.output.Fields) == 0 {
+		return FieldsEncoded
+	}
+	return FieldsDecoded
+}
+
+// begin starts the transaction the next issues are inserted in.
+func (w *dbWriter) begin() error {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin a transaction: %w", err)
+	}
+	w.tx = tx
+	return nil
+}
+
+// prepare prepares the insert statement in the current transaction.
+func (w *dbWriter) prepare() error {
+	insert, err := w.tx.Prepare(w.insertSQL)
+	if err != nil {
+		return fmt.Errorf("failed to prepare the insert statement: %w", err)
+	}
+	w.insert = insert
+	return nil
+}
+
+// commit commits the current transaction.
+func (w *dbWriter) commit() error {
+	tx := w.tx
+	w.tx = nil
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit the transaction: %w", err)
+	}
+	return nil
+}
+
+func (w *dbWriter) WriteIssues(ctx context.Context, issues []JiraIssue) error {
+	// Insert issues into the table
+	for _, issue := range issues {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		values := []interface{}{issue.ID, issue.Key}
+		if len(w.output.Fields) == 0 {
+			values = append(values, fieldsJSON(issue))
+		}
+		for _, m := range w.output.Fields {
+			name, _, _ := strings.Cut(m.Field, ".")
+			if _, ok := issue.Fields[name]; w.partial && !ok {
+				values = append(values, nil)
+				continue
+			}
+			values = append(values, fieldValue(issue.Fields, m.Field))
+		}
+		for _, name := range w.expand {
+			var value interface{}
+			if raw, ok := issue.Expanded[name]; ok {
+				value = string(raw)
+			}
+			values = append(values, value)
+		}
+		if w.epics {
+			values = append(values, issue.EpicKey, issue.EpicSummary)
+		}
+		if w.e.cfg.Provenance {
+			values = append(values, issue.SourceURL, fetchedAt(issue))
+		}
+		if _, err := w.insert.ExecContext(ctx, values...); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("could not insert values in the table: %w", err)
+		}
+	}
+
+	if w.output.BatchCommit {
+		if err := w.commit(); err != nil {
+			return err
+		}
+		if err := w.begin(); err != nil {
+			return err
+		}
+		return w.prepare()
+	}
+	return nil
+}
+
+func (w *dbWriter) Close() error {
+	if w.output.Writer != nil {
+		// The in-memory database stays open for the other tables
+		if err := w.commit(); err != nil {
+			w.closeDB()
+			return err
+		}
+		return nil
+	}
+	if err := w.commit(); err != nil {
+		w.e.releaseDB(w.db)
+		return err
+	}
+	return w.e.releaseDB(w.db)
+}
+
+// abort rolls back the uncommitted issues.
+func (w *dbWriter) Abort() error {
+	defer w.closeDB()
+	if w.tx != nil {
+		return w.tx.Rollback()
+	}
+	return nil
+}
+
+// closeDB closes the database, discarding it when it is held in memory.
+func (w *dbWriter) closeDB() {
+	if w.output.Writer != nil {
+		w.e.closeMemDB()
+		return
+	}
+	w.e.releaseDB(w.db)
+}
+
+// dbLocks serializes the exports of the process writing to the same
+// database file, which would otherwise contend for its write lock.
+var dbLocks = &keyedMutex{locks: make(map[string]*keyedLock)}
+
+// keyedMutex holds a mutex per key, dropped once no one holds or waits for it.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock locks key, waiting for its current holder, and returns the function
+// unlocking it.
+func (k *keyedMutex) lock(key string) func() {
+	k.mu.Lock()
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		k.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
+
+// dbLockKey identifies file whatever the path it is named with.
+func dbLockKey(file string) string {
+	if abs, err := filepath.Abs(file); err == nil {
+		return abs
+	}
+	return file
+}
+
+// openDB opens the database of the DB output at file. With DBOutput.Writer,
+// every table is written to the same in-memory database, opened on first
+// use. Databases are closed with releaseDB, which leaves that one open. A
+// database file is locked for the other exports of the process until it is
+// released.
+func (e *exporter) openDB(file string) (*sql.DB, error) {
+	if e.cfg.DB == nil || e.cfg.DB.Writer == nil {
+		dsn := file
+		if e.cfg.DB != nil && e.cfg.DB.BusyTimeout > 0 {
+			dsn += "?_busy_timeout=" + strconv.FormatInt(e.cfg.DB.BusyTimeout.Milliseconds(), 10)
+		}
+		unlock := dbLocks.lock(dbLockKey(file))
+		db, err := sql.Open("sqlite3", dsn)
+		if err != nil {
+			unlock()
+			return nil, fmt.Errorf("failed to open database file: %w", err)
+		}
+		e.dbUnlocks[db] = unlock
+		return db, nil
+	}
+	if e.memDB != nil {
+		return e.memDB, nil
+	}
+	if e.memDBUsed {
+		return nil, errors.New("the in-memory database was discarded")
+	}
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open in-memory database: %w", err)
+	}
+	// Every connection to :memory: has a database of its own, so a single
+	// one is kept open for the whole export.
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+	e.memDB, e.memDBUsed = db, true
+	return db, nil
+}
+
+// releaseDB closes a database returned by openDB, unless it is the in-memory
+// database.
+func (e *exporter) releaseDB(db *sql.DB) error {
+	if db == e.memDB {
+		return nil
+	}
+	err := db.Close()
+	if unlock, ok := e.dbUnlocks[db]; ok {
+		delete(e.dbUnlocks, db)
+		unlock()
+	}
+	return err
+}
+
+// closeMemDB discards the in-memory database, if any.
+func (e *exporter) closeMemDB() {
+	if e.memDB != nil {
+		e.memDB.Close()
+		e.memDB = nil
+	}
+}
+
+// dumpMemDB serializes the in-memory database to DBOutput.Writer.
+func (e *exporter) dumpMemDB(ctx context.Context) error {
+	conn, err := e.memDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var data []byte
+	err = conn.Raw(func(driverConn interface{}) error {
+		sqliteConn, ok := driverConn.(*sqlite3.SQLiteConn)
+		if !ok {
+			return fmt.Errorf("unexpected driver connection %T", driverConn)
+		}
+		var err error
+		data, err = sqliteConn.Serialize("main")
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to serialize the database: %w", err)
+	}
+	e.logger.Printf("Writing the %d bytes database", len(data))
+	if _, err := e.cfg.DB.Writer.Write(data); err != nil {
+		return fmt.Errorf("failed to write the database: %w", err)
+	}
+	return nil
+}
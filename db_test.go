@@ -0,0 +1,153 @@
+package camembert
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// countRows returns the number of rows of table in the database file, zero
+// when the table does not exist.
+func countRows(t *testing.T, file, table string) int {
+	t.Helper()
+	db, err := sql.Open("sqlite3", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var n int
+	if err := db.QueryRow("SELECT count(*) FROM " + table).Scan(&n); err != nil {
+		if strings.Contains(err.Error(), "no such table") {
+			return 0
+		}
+		t.Fatal(err)
+	}
+	return n
+}
+
+// cancellingJira cancels the export when it is asked for the page at
+// startAt, and fails that page.
+type cancellingJira struct {
+	*fakeJira
+	startAt int
+	cancel  context.CancelFunc
+}
+
+func (c *cancellingJira) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if startAt, _ := strconv.Atoi(r.URL.Query().Get("startAt")); startAt == c.startAt {
+		c.cancel()
+		http.Error(w, "cancelled", http.StatusServiceUnavailable)
+		return
+	}
+	c.fakeJira.ServeHTTP(w, r)
+}
+
+func TestDBCancelledExport(t *testing.T) {
+	tests := []struct {
+		name        string
+		batchCommit bool
+		// wantRows are the rows left by an export cancelled while fetching
+		// its fourth page, one page in flight at a time.
+		wantRows int
+	}{
+		{name: "single transaction", wantRows: 0},
+		{name: "batch commit", batchCommit: true, wantRows: 3 * pageSize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			file := filepath.Join(t.TempDir(), "issues.db")
+			cfg := serve(t, &cancellingJira{fakeJira: &fakeJira{total: 6 * pageSize}, startAt: 3 * pageSize, cancel: cancel})
+			cfg.Stream = true
+			cfg.MaxInFlight = 1
+			cfg.DB = &DBOutput{File: file, Table: "issues", BatchCommit: tt.batchCommit}
+
+			_, err := Export(ctx, cfg)
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("Export() error = %v, want context.Canceled", err)
+			}
+			if got := countRows(t, file, "issues"); got != tt.wantRows {
+				t.Errorf("rows = %d, want %d", got, tt.wantRows)
+			}
+		})
+	}
+}
+
+func TestDBCancelledAppendKeepsRows(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "issues.db")
+	cfg := (&fakeJira{total: 10}).start(t)
+	cfg.DB = &DBOutput{File: file, Table: "issues"}
+	if _, err := Export(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg = serve(t, &cancellingJira{fakeJira: &fakeJira{total: 3 * pageSize}, startAt: 2 * pageSize, cancel: cancel})
+	cfg.Stream = true
+	cfg.MaxInFlight = 1
+	cfg.DB = &DBOutput{File: file, Table: "issues", Append: true}
+	if _, err := Export(ctx, cfg); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Export() error = %v, want context.Canceled", err)
+	}
+	if got := countRows(t, file, "issues"); got != 10 {
+		t.Errorf("rows = %d, want the 10 rows of the first export", got)
+	}
+}
+
+func TestDBConcurrentExportsToOneFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "issues.db")
+	tables := []string{"first", "second"}
+	// served lists, in order, the table of every page served after the
+	// first page of an export.
+	var mu sync.Mutex
+	var served []string
+	errs := make([]error, len(tables))
+	var wg sync.WaitGroup
+	for i, table := range tables {
+		jira := &fakeJira{total: 5 * pageSize}
+		cfg := serve(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("startAt") != "0" {
+				mu.Lock()
+				served = append(served, table)
+				mu.Unlock()
+			}
+			jira.ServeHTTP(w, r)
+		}))
+		cfg.Stream = true
+		cfg.DB = &DBOutput{File: file, Table: table, BatchCommit: true, Append: true}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = Export(context.Background(), cfg)
+		}()
+	}
+	wg.Wait()
+
+	for i, table := range tables {
+		if errs[i] != nil {
+			t.Errorf("export to table %s failed: %v", table, errs[i])
+		}
+		if got := countRows(t, file, table); got != 5*pageSize {
+			t.Errorf("table %s has %d rows, want %d", table, got, 5*pageSize)
+		}
+	}
+	// The export locking the file second fetches its pages once the first
+	// one is done.
+	switches := 0
+	for i := 1; i < len(served); i++ {
+		if served[i] != served[i-1] {
+			switches++
+		}
+	}
+	if switches > 1 {
+		t.Errorf("pages served for the tables %v, want the pages of one export after the other", served)
+	}
+}
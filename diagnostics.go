@@ -0,0 +1,142 @@
+package camembert
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// DiagnosticsOutput configures the pagination diagnostics of an export: one
+// record per requested page with its offset, the page size requested, the
+// page size applied by Jira and the number of issues actually returned. The
+// applied size is left empty when Jira does not report it or the page
+// failed. Comparing them reveals server-side caps and gaps in the pagination.
+type DiagnosticsOutput struct {
+	// CSVFile, when set, receives one row per page.
+	CSVFile string
+	// Table, when set, is created in the database of the DB output.
+	Table string
+}
+
+type pageRecord struct {
+	startAt   int
+	requested int
+	// applied is the page size reported by Jira, zero when unknown.
+	applied  int
+	returned int
+	total    int
+	err      error
+}
+
+// pageLog collects the page records of an export from every worker.
+type pageLog struct {
+	mu      sync.Mutex
+	records []pageRecord
+}
+
+func (l *pageLog) add(r pageRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records = append(l.records, r)
+}
+
+func (l *pageLog) sorted() []pageRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	records := append([]pageRecord(nil), l.records...)
+	sort.SliceStable(records, func(i, j int) bool { return records[i].startAt < records[j].startAt })
+	return records
+}
+
+func (r pageRecord) appliedString() string {
+	if r.applied == 0 {
+		return ""
+	}
+	return strconv.Itoa(r.applied)
+}
+
+func (r pageRecord) errorString() string {
+	if r.err == nil {
+		return ""
+	}
+	return r.err.Error()
+}
+
+func (e *exporter) exportDiagnostics(output DiagnosticsOutput) error {
+	records := e.pages.sorted()
+	if output.CSVFile != "" {
+		if err := e.saveDiagnosticsToCSV(records, output.CSVFile); err != nil {
+			return err
+		}
+	}
+	if output.Table != "" {
+		if err := e.saveDiagnosticsToDB(records, e.cfg.DB.File, output.Table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *exporter) saveDiagnosticsToCSV(records []pageRecord, csvFile string) error {
+	e.logger.Printf("Saving pagination diagnostics to CSV file: %s", csvFile)
+	file, err := os.Create(csvFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	headers := []string{"StartAt", "Requested", "Applied", "Returned", "Total", "Error"}
+	if err := writer.Write(headers); err != nil {
+		return fmt.Errorf("failed to write CSV headers: %w", err)
+	}
+	for _, r := range records {
+		record := []string{strconv.Itoa(r.startAt), strconv.Itoa(r.requested), r.appliedString(), strconv.Itoa(r.returned), strconv.Itoa(r.total), r.errorString()}
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("failed to write data in CSV file: %w", err)
+		}
+	}
+	return nil
+}
+
+func (e *exporter) saveDiagnosticsToDB(records []pageRecord, dbFile string, tableName string) error {
+	e.logger.Printf("Saving pagination diagnostics to DB file %s in table %s.", dbFile, tableName)
+
+	db, err := e.openDB(dbFile)
+	if err != nil {
+		return err
+	}
+	defer e.releaseDB(db)
+
+	createTableSQL := fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s (
+		start_at INTEGER,
+		requested INTEGER,
+		applied INTEGER,
+		returned INTEGER,
+		total INTEGER,
+		error TEXT
+	);`, tableName)
+	if _, err := db.Exec(createTableSQL); err != nil {
+		return fmt.Errorf("failed to create the table in the database: %w", err)
+	}
+
+	// The table describes the latest export only
+	if _, err := db.Exec(fmt.Sprintf(`DELETE FROM %s`, tableName)); err != nil {
+		return fmt.Errorf("failed to clear the table: %w", err)
+	}
+	insertSQL := fmt.Sprintf(`INSERT INTO %s (start_at, requested, applied, returned, total, error) VALUES (?, ?, ?, ?, ?, ?)`, tableName)
+	for _, r := range records {
+		applied := sql.NullInt64{Int64: int64(r.applied), Valid: r.applied > 0}
+		if _, err := db.Exec(insertSQL, r.startAt, r.requested, applied, r.returned, r.total, r.errorString()); err != nil {
+			return fmt.Errorf("could not insert values in the table: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package camembert
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestDiagnosticsPageSize(t *testing.T) {
+	tests := []struct {
+		name string
+		jira *fakeJira
+		want [][]string
+	}{
+		{
+			name: "reported",
+			jira: &fakeJira{total: 450, limit: 200},
+			want: [][]string{{"0", "1000", "200", "200", "450", ""}, {"200", "1000", "200", "200", "450", ""}, {"400", "1000", "200", "50", "450", ""}},
+		},
+		{
+			name: "unreported",
+			jira: &fakeJira{total: 450, limit: 200, hideLimit: true},
+			want: [][]string{{"0", "1000", "", "200", "450", ""}, {"200", "1000", "", "200", "450", ""}, {"400", "1000", "", "50", "450", ""}},
+		},
+		{
+			name: "uncapped",
+			jira: &fakeJira{total: 10},
+			want: [][]string{{"0", "1000", "1000", "10", "10", ""}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "pages.csv")
+			cfg := tt.jira.start(t)
+			cfg.Writers = []Writer{&keyWriter{}}
+			cfg.Diagnostics = &DiagnosticsOutput{CSVFile: file}
+			if _, err := Export(context.Background(), cfg); err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := os.Open(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			records, err := csv.NewReader(f).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(records[1:], tt.want) {
+				t.Errorf("diagnostics = %v, want %v", records[1:], tt.want)
+			}
+		})
+	}
+}
+
+func TestDiagnosticsFailedPage(t *testing.T) {
+	jira := &fakeJira{total: 450, limit: 200}
+	cfg := serve(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("startAt") == "200" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		jira.ServeHTTP(w, r)
+	}))
+	file := filepath.Join(t.TempDir(), "issues.db")
+	cfg.DB = &DBOutput{File: file, Table: "issues"}
+	cfg.Diagnostics = &DiagnosticsOutput{Table: "pages"}
+	if _, err := Export(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite3", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	rows, err := db.Query("SELECT start_at, requested, applied, error FROM pages ORDER BY start_at")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var startAt, requested int
+		var applied sql.NullInt64
+		var errText string
+		if err := rows.Scan(&startAt, &requested, &applied, &errText); err != nil {
+			t.Fatal(err)
+		}
+		row := strconv.Itoa(startAt) + " " + strconv.Itoa(requested) + " "
+		if applied.Valid {
+			row += strconv.FormatInt(applied.Int64, 10)
+		} else {
+			row += "NULL"
+		}
+		if errText != "" {
+			row += " failed"
+		}
+		got = append(got, row)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"0 1000 200", "200 1000 NULL failed", "400 1000 200"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diagnostics = %q, want %q", got, want)
+	}
+}
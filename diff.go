@@ -0,0 +1,209 @@
+package camembert
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"sort"
+)
+
+// IssueChange is an issue present in both exports compared by Diff whose
+// fields differ.
+type IssueChange struct {
+	Key string
+	// Fields lists the sorted IDs of the fields added, removed or changed.
+	Fields []string
+}
+
+// DiffResult lists the differences between two exports, by issue key.
+type DiffResult struct {
+	Added   []string
+	Removed []string
+	Changed []IssueChange
+}
+
+// Diff compares the issues stored in tableName by two exports of the same
+// project, such as the databases of two runs, and reports the issues added,
+// removed and changed between them. base names the id, key and fields
+// columns of the table, as DBOutput.Columns names them. Fields are compared from
+// the fields column when the table has one, otherwise from the mapped
+// columns. The provenance, epic and expanded property columns are not
+// compared.
+func Diff(before *sql.DB, after *sql.DB, tableName string, base BaseColumns) (DiffResult, error) {
+	beforeIssues, err := tableIssues(before, tableName, base)
+	if err != nil {
+		return DiffResult{}, fmt.Errorf("failed to read the earlier export: %w", err)
+	}
+	afterIssues, err := tableIssues(after, tableName, base)
+	if err != nil {
+		return DiffResult{}, fmt.Errorf("failed to read the later export: %w", err)
+	}
+	return diffIssues(beforeIssues, afterIssues), nil
+}
+
+// DiffCSV compares two CSV files written by the CSV output the way Diff
+// compares databases.
+func DiffCSV(before io.Reader, after io.Reader) (DiffResult, error) {
+	beforeIssues, err := csvIssues(before)
+	if err != nil {
+		return DiffResult{}, fmt.Errorf("failed to read the earlier export: %w", err)
+	}
+	afterIssues, err := csvIssues(after)
+	if err != nil {
+		return DiffResult{}, fmt.Errorf("failed to read the later export: %w", err)
+	}
+	return diffIssues(beforeIssues, afterIssues), nil
+}
+
+// exportedIssues maps issue keys to their fields as stored by an output.
+type exportedIssues map[string]map[string]interface{}
+
+// expandProperties are the issue properties Config.Expand may request, each
+// written to its own column.
+var expandProperties = []string{"renderedFields", "names", "schema", "transitions", "operations", "editmeta", "changelog", "versionedRepresentations"}
+
+// derivedColumn reports whether column is written besides the fields of
+// issues: the provenance, which changes with every run, and the epic and
+// expanded properties, which are derived from the fields or describe the
+// request. Diff leaves them out of the comparison.
+func derivedColumn(column string) bool {
+	return slices.Contains(provenanceColumns, column) || slices.Contains(epicColumns, column) || slices.Contains(expandProperties, column)
+}
+
+// storedFields rebuilds the fields of a stored row, leaving out its id and
+// key columns and decoding its fields column when there is one.
+func storedFields(columns []string, record []string, idColumn, keyColumn, fieldsColumn string) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	for i, column := range columns {
+		switch {
+		case column == idColumn, column == keyColumn, derivedColumn(column):
+		case column == fieldsColumn:
+			if record[i] == "" {
+				continue
+			}
+			if err := decodeJSON([]byte(record[i]), &fields); err != nil {
+				return nil, fmt.Errorf("invalid fields: %w", err)
+			}
+		default:
+			fields[column] = record[i]
+		}
+	}
+	return fields, nil
+}
+
+func tableIssues(db *sql.DB, tableName string, base BaseColumns) (exportedIssues, error) {
+	rows, err := db.Query(fmt.Sprintf(`SELECT * FROM %s`, tableName))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	keyColumn := slices.Index(columns, base.key())
+	if keyColumn < 0 {
+		return nil, fmt.Errorf("no %s column in %s", base.key(), tableName)
+	}
+
+	issues := make(exportedIssues)
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	record := make([]string, len(columns))
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		for i, value := range values {
+			record[i] = sqlValueString(value)
+		}
+		fields, err := storedFields(columns, record, base.id(), base.key(), base.fields())
+		if err != nil {
+			return nil, fmt.Errorf("issue %s: %w", record[keyColumn], err)
+		}
+		issues[record[keyColumn]] = fields
+	}
+	return issues, rows.Err()
+}
+
+func csvIssues(r io.Reader) (exportedIssues, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return exportedIssues{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	keyColumn := slices.Index(header, "Key")
+	if keyColumn < 0 {
+		return nil, fmt.Errorf("no Key column")
+	}
+
+	issues := make(exportedIssues)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return issues, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < len(header) {
+			return nil, fmt.Errorf("line has %d columns, expected %d", len(record), len(header))
+		}
+		fields, err := storedFields(header, record, "ID", "Key", "Fields")
+		if err != nil {
+			return nil, fmt.Errorf("issue %s: %w", record[keyColumn], err)
+		}
+		issues[record[keyColumn]] = fields
+	}
+}
+
+func diffIssues(before exportedIssues, after exportedIssues) DiffResult {
+	var result DiffResult
+	for key, afterFields := range after {
+		beforeFields, ok := before[key]
+		if !ok {
+			result.Added = append(result.Added, key)
+			continue
+		}
+		if changed := changedFieldNames(beforeFields, afterFields); len(changed) > 0 {
+			result.Changed = append(result.Changed, IssueChange{Key: key, Fields: changed})
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			result.Removed = append(result.Removed, key)
+		}
+	}
+	sort.Strings(result.Added)
+	sort.Strings(result.Removed)
+	sort.Slice(result.Changed, func(i, j int) bool { return result.Changed[i].Key < result.Changed[j].Key })
+	return result
+}
+
+// changedFieldNames returns the sorted names of the fields that differ.
+func changedFieldNames(before map[string]interface{}, after map[string]interface{}) []string {
+	var changed []string
+	for name, value := range after {
+		if beforeValue, ok := before[name]; !ok || !reflect.DeepEqual(beforeValue, value) {
+			changed = append(changed, name)
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
@@ -0,0 +1,94 @@
+package camembert
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffCSVIgnoresDerivedColumns(t *testing.T) {
+	before := "ID,Key,summary,editmeta,epic_key,epic_summary,source_url,fetched_at\n" +
+		"1,P-1,same,{},E-1,Epic,http://jira/a?startAt=0,2024-05-01T10:00:00Z\n" +
+		"2,P-2,old,{},,,http://jira/a?startAt=0,2024-05-01T10:00:00Z\n" +
+		"3,P-3,gone,{},,,http://jira/a?startAt=0,2024-05-01T10:00:00Z\n"
+	after := "ID,Key,summary,editmeta,epic_key,epic_summary,source_url,fetched_at\n" +
+		"1,P-1,same,\"{\"\"fields\"\":{}}\",E-1,Epic renamed,http://jira/a?startAt=1000,2024-05-02T10:00:00Z\n" +
+		"2,P-2,new,{},,,http://jira/a?startAt=0,2024-05-02T10:00:00Z\n" +
+		"4,P-4,added,{},,,http://jira/a?startAt=0,2024-05-02T10:00:00Z\n"
+	got, err := DiffCSV(strings.NewReader(before), strings.NewReader(after))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DiffResult{
+		Added:   []string{"P-4"},
+		Removed: []string{"P-3"},
+		Changed: []IssueChange{{Key: "P-2", Fields: []string{"summary"}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffCSV() = %+v, want %+v", got, want)
+	}
+}
+
+func TestDiffIgnoresProvenance(t *testing.T) {
+	open := func(rows ...string) *sql.DB {
+		db, err := sql.Open("sqlite3", ":memory:")
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.SetMaxOpenConns(1)
+		t.Cleanup(func() { db.Close() })
+		if _, err := db.Exec(`CREATE TABLE issues (id TEXT PRIMARY KEY, key TEXT, fields TEXT, source_url TEXT, fetched_at TEXT)`); err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range rows {
+			if _, err := db.Exec(`INSERT INTO issues VALUES ` + row); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return db
+	}
+	before := open(`('1', 'P-1', '{"summary":"a"}', 'http://jira/a', '2024-05-01T10:00:00Z')`, `('2', 'P-2', '{"summary":"b"}', 'http://jira/a', '2024-05-01T10:00:00Z')`)
+	after := open(`('1', 'P-1', '{"summary":"a"}', 'http://jira/b', '2024-05-02T10:00:00Z')`, `('2', 'P-2', '{"summary":"c"}', 'http://jira/a', '2024-05-02T10:00:00Z')`)
+	got, err := Diff(before, after, "issues", BaseColumns{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []IssueChange{{Key: "P-2", Fields: []string{"summary"}}}; !reflect.DeepEqual(got.Changed, want) {
+		t.Errorf("Diff() changed = %+v, want %+v", got.Changed, want)
+	}
+}
+
+func TestDiffRenamedColumns(t *testing.T) {
+	columns := BaseColumns{ID: "issue_id", Key: "issue_key", Fields: "payload"}
+	export := func(edit func(i int, issue map[string]interface{})) *sql.DB {
+		file := filepath.Join(t.TempDir(), "issues.db")
+		cfg := (&fakeJira{total: 3, edit: edit}).start(t)
+		cfg.DB = &DBOutput{File: file, Table: "issues", Columns: columns}
+		if _, err := Export(context.Background(), cfg); err != nil {
+			t.Fatal(err)
+		}
+		db, err := sql.Open("sqlite3", file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+	before := export(nil)
+	after := export(func(i int, issue map[string]interface{}) {
+		if i == 1 {
+			issue["fields"].(map[string]interface{})["summary"] = fmt.Sprintf("issue %d renamed", i)
+		}
+	})
+	got, err := Diff(before, after, "issues", columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (DiffResult{Changed: []IssueChange{{Key: "P-1", Fields: []string{"summary"}}}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,131 @@
+package camembert
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Endpoint selects the Jira API issues are exported from.
+type Endpoint int
+
+const (
+	// EndpointSearch pages through the issue search API at JiraBaseURL.
+	// Agile resources returning the same response shape, such as the issues
+	// of a board, can be used as JiraBaseURL as well.
+	EndpointSearch Endpoint = iota
+	// EndpointServiceDesk pages through the customer requests of a Jira
+	// Service Management service desk. A request is exported as an issue
+	// whose fields are its request field values and request metadata.
+	EndpointServiceDesk
+)
+
+// pageSource requests a page of issues from an endpoint and reads it.
+type pageSource interface {
+	fetchPage(ctx context.Context, e *exporter, startAt int) (JiraResponse, error)
+}
+
+// boundedSource is implemented by sources that know how many pages they
+// return without reporting a total, so that no page past the last one is
+// requested ahead.
+type boundedSource interface {
+	pageCount() int
+}
+
+func (c Config) source() pageSource {
+	switch {
+	case c.Endpoint == EndpointServiceDesk:
+		return serviceDeskSource{}
+	case len(c.IssueKeys) > 0:
+		return keysSource{chunks: keyChunks(c.IssueKeys)}
+	case c.ChangedFieldsOnly:
+		return changedFieldsSource{}
+	}
+	return searchSource{}
+}
+
+// searchSource pages through the issue search API.
+type searchSource struct{}
+
+func (searchSource) fetchPage(ctx context.Context, e *exporter, startAt int) (JiraResponse, error) {
+	return searchPage(ctx, e, e.cfg.searchJQL(), startAt, e.fields, e.cfg.Expand)
+}
+
+// searchPage requests the page at startAt of the issues matched by jql, with
+// the given fields and expanded properties.
+func searchPage(ctx context.Context, e *exporter, jql string, startAt int, fields string, expand []string) (JiraResponse, error) {
+	// Set query parameters
+	q := url.Values{}
+	q.Add("jql", jql)
+	q.Add("startAt", strconv.Itoa(startAt))
+	q.Add("maxResults", strconv.Itoa(pageSize))
+	q.Add("fields", fields)
+	if len(expand) > 0 {
+		q.Add("expand", strings.Join(expand, ","))
+	}
+
+	var jiraResponse JiraResponse
+	if err := e.getJSON(ctx, e.cfg.JiraBaseURL, q, &jiraResponse); err != nil {
+		return JiraResponse{}, err
+	}
+	e.stampProvenance(jiraResponse.Issues, e.cfg.JiraBaseURL, q)
+	return jiraResponse, nil
+}
+
+// serviceDeskSource pages through the customer requests API, which reports
+// whether a page is the last one instead of a total.
+type serviceDeskSource struct{}
+
+type serviceDeskResponse struct {
+	IsLastPage bool                 `json:"isLastPage"`
+	Limit      int                  `json:"limit"`
+	Values     []serviceDeskRequest `json:"values"`
+}
+
+type serviceDeskRequest struct {
+	IssueID            string                  `json:"issueId"`
+	IssueKey           string                  `json:"issueKey"`
+	RequestTypeID      string                  `json:"requestTypeId"`
+	ServiceDeskID      string                  `json:"serviceDeskId"`
+	CreatedDate        interface{}             `json:"createdDate"`
+	Reporter           interface{}             `json:"reporter"`
+	CurrentStatus      interface{}             `json:"currentStatus"`
+	RequestFieldValues []serviceDeskFieldValue `json:"requestFieldValues"`
+}
+
+type serviceDeskFieldValue struct {
+	FieldID string      `json:"fieldId"`
+	Value   interface{} `json:"value"`
+}
+
+func (serviceDeskSource) fetchPage(ctx context.Context, e *exporter, startAt int) (JiraResponse, error) {
+	q := url.Values{}
+	q.Add("serviceDeskId", e.cfg.ServiceDeskID)
+	q.Add("requestOwnership", "ALL_REQUESTS")
+	q.Add("start", strconv.Itoa(startAt))
+	q.Add("limit", strconv.Itoa(pageSize))
+
+	var resp serviceDeskResponse
+	requestURL := e.cfg.siteURL() + "/rest/servicedeskapi/request"
+	if err := e.getJSON(ctx, requestURL, q, &resp); err != nil {
+		return JiraResponse{}, err
+	}
+
+	page := JiraResponse{Total: -1, MaxResults: resp.Limit, last: resp.IsLastPage || len(resp.Values) == 0}
+	for _, r := range resp.Values {
+		fields := map[string]interface{}{
+			"requestTypeId": r.RequestTypeID,
+			"serviceDeskId": r.ServiceDeskID,
+			"createdDate":   r.CreatedDate,
+			"reporter":      r.Reporter,
+			"currentStatus": r.CurrentStatus,
+		}
+		for _, v := range r.RequestFieldValues {
+			fields[v.FieldID] = v.Value
+		}
+		page.Issues = append(page.Issues, JiraIssue{ID: r.IssueID, Key: r.IssueKey, Fields: fields})
+	}
+	e.stampProvenance(page.Issues, requestURL, q)
+	return page, nil
+}
@@ -0,0 +1,125 @@
+package camembert
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// fakeServiceDesk serves the customer requests of service desk 7 over total
+// requests, SD-0 to SD-<total-1>, limit per page.
+type fakeServiceDesk struct {
+	total int
+	limit int
+
+	mu     sync.Mutex
+	starts []int
+}
+
+func (f *fakeServiceDesk) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/rest/servicedeskapi/request" || r.URL.Query().Get("serviceDeskId") != "7" {
+		http.NotFound(w, r)
+		return
+	}
+	start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+	f.mu.Lock()
+	f.starts = append(f.starts, start)
+	f.mu.Unlock()
+
+	values := []map[string]interface{}{}
+	for i := start; i < start+f.limit && i < f.total; i++ {
+		values = append(values, map[string]interface{}{
+			"issueId":       strconv.Itoa(20000 + i),
+			"issueKey":      fmt.Sprintf("SD-%d", i),
+			"requestTypeId": "3",
+			"serviceDeskId": "7",
+			"currentStatus": map[string]interface{}{"status": "Waiting for support"},
+			"requestFieldValues": []map[string]interface{}{
+				{"fieldId": "summary", "value": fmt.Sprintf("request %d", i)},
+			},
+		})
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"values":     values,
+		"limit":      f.limit,
+		"isLastPage": start+f.limit >= f.total,
+	})
+}
+
+// issueWriter keeps the issues it is handed.
+type issueWriter struct {
+	mu     sync.Mutex
+	issues []JiraIssue
+}
+
+func (w *issueWriter) WriteIssues(ctx context.Context, issues []JiraIssue) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.issues = append(w.issues, issues...)
+	return nil
+}
+
+func (w *issueWriter) Close() error { return nil }
+func (w *issueWriter) Abort() error { return nil }
+
+func TestExportServiceDesk(t *testing.T) {
+	desk := &fakeServiceDesk{total: 5, limit: 2}
+	cfg := serve(t, desk)
+	cfg.ProjectKey = ""
+	cfg.Endpoint = EndpointServiceDesk
+	cfg.ServiceDeskID = "7"
+	writer := &issueWriter{}
+	cfg.Writers = []Writer{writer}
+	result, err := Export(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Written != 5 || len(writer.issues) != 5 {
+		t.Fatalf("wrote %d requests, result %+v, want the 5 requests", len(writer.issues), result)
+	}
+
+	byKey := make(map[string]JiraIssue)
+	for _, issue := range writer.issues {
+		byKey[issue.Key] = issue
+	}
+	for i := range 5 {
+		issue, ok := byKey[fmt.Sprintf("SD-%d", i)]
+		if !ok {
+			t.Errorf("request SD-%d was not written", i)
+			continue
+		}
+		if want := strconv.Itoa(20000 + i); issue.ID != want {
+			t.Errorf("SD-%d ID = %q, want %q", i, issue.ID, want)
+		}
+		if got, want := issue.Fields["summary"], fmt.Sprintf("request %d", i); got != want {
+			t.Errorf("SD-%d summary = %v, want the request field value %q", i, got, want)
+		}
+		if got := fieldValue(issue.Fields, "currentStatus.status"); got != "Waiting for support" {
+			t.Errorf("SD-%d currentStatus.status = %q, want the request metadata", i, got)
+		}
+	}
+
+	// Without a total, pages past the last one may be requested ahead, but
+	// all follow each other by the limit applied.
+	desk.mu.Lock()
+	defer desk.mu.Unlock()
+	for _, start := range desk.starts {
+		if start%2 != 0 {
+			t.Errorf("requested a page at %d, want pages by the limit of 2", start)
+		}
+	}
+}
+
+func TestExportServiceDeskRequiresID(t *testing.T) {
+	cfg := serve(t, &fakeServiceDesk{})
+	cfg.ProjectKey = ""
+	cfg.Endpoint = EndpointServiceDesk
+	cfg.Writers = []Writer{&keyWriter{}}
+	if _, err := Export(context.Background(), cfg); err == nil {
+		t.Fatal("Export() without a ServiceDeskID succeeded, want an error")
+	}
+}
@@ -0,0 +1,97 @@
+package camembert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// EpicRollup adds the key and summary of the epic each issue belongs to as
+// epic_key and epic_summary columns of the CSV and DB outputs.
+type EpicRollup struct {
+	// Field is the ID of the epic link custom field, for example
+	// "customfield_10014". When empty, the parent of the issue is used, as
+	// in team-managed projects and recent Jira Cloud versions. The parent of
+	// a sub-task is its parent issue rather than an epic.
+	Field string
+}
+
+// epicColumns are the columns added by EpicRollup.
+var epicColumns = []string{"epic_key", "epic_summary"}
+
+// field returns the field holding the epic reference.
+func (r EpicRollup) field() string {
+	if r.Field == "" {
+		return "parent"
+	}
+	return r.Field
+}
+
+// epic returns the key of the epic referenced by issue, if any, and its
+// summary when embedded in the reference, as it is for parents.
+func (r EpicRollup) epic(issue JiraIssue) (key string, summary string, ok bool) {
+	switch v := issue.Fields[r.field()].(type) {
+	case string:
+		return v, "", false
+	case map[string]interface{}:
+		key, _ = v["key"].(string)
+		summary, ok = fieldAt(v, "fields.summary").(string)
+		return key, summary, ok
+	}
+	return "", "", false
+}
+
+// epicSummaries caches the summary of every epic fetched during an export,
+// so that an epic is fetched once whatever the number of its children.
+type epicSummaries map[string]string
+
+// fetchEpicSummary fetches the summary of the epic with the given key. Epics
+// that no longer exist or cannot be seen get an empty summary.
+func (e *exporter) fetchEpicSummary(ctx context.Context, key string) (string, error) {
+	var epic struct {
+		Fields struct {
+			Summary string `json:"summary"`
+		} `json:"fields"`
+	}
+	q := url.Values{}
+	q.Set("fields", "summary")
+	epicURL := fmt.Sprintf("%s/rest/api/%d/issue/%s", e.cfg.siteURL(), e.cfg.apiVersion(), url.PathEscape(key))
+	err := e.getJSON(ctx, epicURL, q, &epic)
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		e.logger.Printf("Epic %s not found, it may have been deleted or not be visible", key)
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return epic.Fields.Summary, nil
+}
+
+// addEpics sets the epic of every issue, fetching each epic not seen yet.
+func (e *exporter) addEpics(ctx context.Context, issues []JiraIssue) error {
+	rollup := *e.cfg.Epics
+	for i := range issues {
+		key, summary, embedded := rollup.epic(issues[i])
+		if key == "" {
+			continue
+		}
+		if embedded {
+			e.epics[key] = summary
+		}
+		summary, ok := e.epics[key]
+		if !ok {
+			var err error
+			summary, err = e.fetchEpicSummary(ctx, key)
+			if err != nil {
+				return fmt.Errorf("failed to fetch epic %s: %w", key, err)
+			}
+			e.epics[key] = summary
+		}
+		issues[i].EpicKey = key
+		issues[i].EpicSummary = summary
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package camembert
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEpicSummaryAPIVersion(t *testing.T) {
+	for _, version := range []string{"2", "3"} {
+		t.Run("v"+version, func(t *testing.T) {
+			jira := &fakeJira{total: 3, edit: func(i int, issue map[string]interface{}) {
+				issue["fields"].(map[string]interface{})["customfield_10014"] = "E-1"
+			}}
+			mux := http.NewServeMux()
+			mux.Handle("/rest/api/"+version+"/search", jira)
+			mux.HandleFunc("/rest/api/"+version+"/issue/E-1", func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(map[string]interface{}{"key": "E-1", "fields": map[string]interface{}{"summary": "The epic"}})
+			})
+			cfg := serve(t, mux)
+			cfg.JiraBaseURL = strings.Replace(cfg.JiraBaseURL, "/rest/api/2/", "/rest/api/"+version+"/", 1)
+			file := filepath.Join(t.TempDir(), "issues.csv")
+			cfg.CSV = &CSVOutput{File: file, Fields: []FieldMapping{{Field: "summary"}}}
+			cfg.Epics = &EpicRollup{Field: "customfield_10014"}
+			if _, err := Export(context.Background(), cfg); err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := os.Open(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			records, err := csv.NewReader(f).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			summary := -1
+			for i, column := range records[0] {
+				if column == "epic_summary" {
+					summary = i
+				}
+			}
+			if summary < 0 || len(records) != 4 {
+				t.Fatalf("CSV = %v, want 3 issues with an epic_summary column", records)
+			}
+			for _, record := range records[1:] {
+				if record[summary] != "The epic" {
+					t.Errorf("epic_summary = %q, want the summary fetched from the v%s API", record[summary], version)
+				}
+			}
+		})
+	}
+}
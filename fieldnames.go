@@ -0,0 +1,218 @@
+package camembert
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// FieldsOutput configures the export of the definitions of every field known
+// to Jira, with their schema, for generating typed schemas downstream.
+type FieldsOutput struct {
+	// CSVFile, when set, receives one row per field.
+	CSVFile string
+	// Table, when set, is created in the database of the DB output.
+	Table string
+}
+
+// jiraField is a field as described by the field endpoint.
+type jiraField struct {
+	ID          string   `json:"id"`
+	Key         string   `json:"key"`
+	Name        string   `json:"name"`
+	Custom      bool     `json:"custom"`
+	Orderable   bool     `json:"orderable"`
+	Navigable   bool     `json:"navigable"`
+	Searchable  bool     `json:"searchable"`
+	ClauseNames []string `json:"clauseNames"`
+	Schema      struct {
+		Type     string      `json:"type"`
+		Items    string      `json:"items"`
+		System   string      `json:"system"`
+		Custom   string      `json:"custom"`
+		CustomID json.Number `json:"customId"`
+	} `json:"schema"`
+}
+
+// fetchJiraFields returns every field known to Jira, fetched once per export.
+func (e *exporter) fetchJiraFields(ctx context.Context) ([]jiraField, error) {
+	if e.jiraFields != nil {
+		return e.jiraFields, nil
+	}
+	var fields []jiraField
+	if err := e.getJSON(ctx, e.cfg.siteURL()+"/rest/api/2/field", nil, &fields); err != nil {
+		return nil, err
+	}
+	e.jiraFields = fields
+	return fields, nil
+}
+
+// fetchFieldNames returns the display name of every field, keyed by field ID.
+// Names shared by several fields are suffixed with the field ID so that
+// columns stay unique.
+func (e *exporter) fetchFieldNames(ctx context.Context) (map[string]string, error) {
+	fields, err := e.fetchJiraFields(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	count := make(map[string]int)
+	for _, field := range fields {
+		count[field.Name]++
+	}
+	names := make(map[string]string, len(fields))
+	for _, field := range fields {
+		switch {
+		case field.Name == "":
+		case count[field.Name] > 1:
+			names[field.ID] = fmt.Sprintf("%s (%s)", field.Name, field.ID)
+		default:
+			names[field.ID] = field.Name
+		}
+	}
+	return names, nil
+}
+
+// resolveFieldNames fetches the field names used as CSV columns. The field
+// endpoint is forbidden on some restricted instances, in which case columns
+// fall back to field IDs unless RequireFieldNames is set.
+func (e *exporter) resolveFieldNames(ctx context.Context) error {
+	names, err := e.fetchFieldNames(ctx)
+	if err != nil {
+		if e.cfg.RequireFieldNames {
+			return fmt.Errorf("failed to fetch field names: %w", err)
+		}
+		e.logger.Printf("Warning: failed to fetch field names, using field IDs instead: %v", err)
+		return nil
+	}
+	e.fieldNames = names
+	return nil
+}
+
+// checkRequestedFields applies Config.UnknownFields to the requested fields
+// that Jira does not know, before the first search. When the field endpoint
+// cannot be read, the fields are requested unchecked.
+func (e *exporter) checkRequestedFields(ctx context.Context) error {
+	if e.cfg.UnknownFields == UnknownFieldsKeep || e.fields == "*all" {
+		return nil
+	}
+	fields, err := e.fetchJiraFields(ctx)
+	if err != nil {
+		e.logger.Printf("Warning: failed to fetch fields, requesting them unchecked: %v", err)
+		return nil
+	}
+	known := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		known[field.ID] = true
+	}
+
+	var kept, unknown []string
+	for _, name := range strings.Split(e.fields, ",") {
+		// Keep selectors such as *navigable and exclusions such as -comment
+		if known[name] || strings.HasPrefix(name, "*") || strings.HasPrefix(name, "-") {
+			kept = append(kept, name)
+		} else {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	if e.cfg.UnknownFields == UnknownFieldsFail {
+		return fmt.Errorf("unknown fields requested: %s", strings.Join(unknown, ", "))
+	}
+	e.logger.Printf("Warning: dropping unknown fields from the request: %s", strings.Join(unknown, ", "))
+	if len(kept) == 0 {
+		kept = []string{"*all"}
+	}
+	e.fields = strings.Join(kept, ",")
+	return nil
+}
+
+func (e *exporter) exportFieldDefinitions(ctx context.Context, output FieldsOutput) error {
+	fields, err := e.fetchJiraFields(ctx)
+	if err != nil {
+		return err
+	}
+	if output.CSVFile != "" {
+		if err := e.saveFieldsToCSV(fields, output.CSVFile); err != nil {
+			return err
+		}
+	}
+	if output.Table != "" {
+		if err := e.saveFieldsToDB(fields, e.cfg.DB.File, output.Table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *exporter) saveFieldsToCSV(fields []jiraField, csvFile string) error {
+	e.logger.Printf("Saving field definitions to CSV file: %s", csvFile)
+	file, err := os.Create(csvFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	headers := []string{"ID", "Key", "Name", "Custom", "Orderable", "Navigable", "Searchable", "ClauseNames", "SchemaType", "SchemaItems", "SchemaSystem", "SchemaCustom", "SchemaCustomID"}
+	if err := writer.Write(headers); err != nil {
+		return fmt.Errorf("failed to write CSV headers: %w", err)
+	}
+	for _, f := range fields {
+		record := []string{f.ID, f.Key, f.Name, strconv.FormatBool(f.Custom), strconv.FormatBool(f.Orderable), strconv.FormatBool(f.Navigable), strconv.FormatBool(f.Searchable),
+			strings.Join(f.ClauseNames, ","), f.Schema.Type, f.Schema.Items, f.Schema.System, f.Schema.Custom, f.Schema.CustomID.String()}
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("failed to write data in CSV file: %w", err)
+		}
+	}
+	return nil
+}
+
+func (e *exporter) saveFieldsToDB(fields []jiraField, dbFile string, tableName string) error {
+	e.logger.Printf("Saving field definitions to DB file %s in table %s.", dbFile, tableName)
+
+	db, err := e.openDB(dbFile)
+	if err != nil {
+		return err
+	}
+	defer e.releaseDB(db)
+
+	createTableSQL := fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s (
+		id TEXT PRIMARY KEY,
+		key TEXT,
+		name TEXT,
+		custom INTEGER,
+		orderable INTEGER,
+		navigable INTEGER,
+		searchable INTEGER,
+		clause_names TEXT,
+		schema_type TEXT,
+		schema_items TEXT,
+		schema_system TEXT,
+		schema_custom TEXT,
+		schema_custom_id TEXT
+	);`, tableName)
+	if _, err := db.Exec(createTableSQL); err != nil {
+		return fmt.Errorf("failed to create the table in the database: %w", err)
+	}
+
+	insertSQL := fmt.Sprintf(`INSERT OR REPLACE INTO %s (id, key, name, custom, orderable, navigable, searchable, clause_names, schema_type, schema_items, schema_system, schema_custom, schema_custom_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, tableName)
+	for _, f := range fields {
+		clauseNames, _ := json.Marshal(f.ClauseNames)
+		_, err := db.Exec(insertSQL, f.ID, f.Key, f.Name, f.Custom, f.Orderable, f.Navigable, f.Searchable, string(clauseNames),
+			f.Schema.Type, f.Schema.Items, f.Schema.System, f.Schema.Custom, f.Schema.CustomID.String())
+		if err != nil {
+			return fmt.Errorf("could not insert values in the table: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package camembert
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// MissingFieldPolicy controls how fields that are present on some issues but
+// absent from others are handled. Jira omits fields the authenticated user is
+// not allowed to see instead of returning them as null, so the field set can
+// vary from one issue to the next.
+type MissingFieldPolicy int
+
+const (
+	// MissingFieldsIgnore leaves issues as returned by Jira.
+	MissingFieldsIgnore MissingFieldPolicy = iota
+	// MissingFieldsWarn logs every field missing from some of the issues.
+	MissingFieldsWarn
+	// MissingFieldsFill adds missing fields to each issue as explicit nulls,
+	// so every output sees the same field set for all issues.
+	MissingFieldsFill
+)
+
+// FieldsPreset selects a predefined list of fields requested from Jira, so
+// that exports stay fast without naming fields. Requesting every field can
+// include expensive aggregated and plugin fields that slow each request.
+type FieldsPreset int
+
+const (
+	// FieldsPresetNone requests Config.Fields, or the fields selected by
+	// the outputs.
+	FieldsPresetNone FieldsPreset = iota
+	// FieldsMinimal requests summary, status, issuetype and updated.
+	FieldsMinimal
+	// FieldsReporting requests the fields of the usual reports: summary,
+	// status, issuetype, priority, assignee, reporter, created, updated,
+	// resolutiondate and labels.
+	FieldsReporting
+	// FieldsAll requests every field, *all, whatever the outputs select.
+	FieldsAll
+)
+
+// presetFields holds the fields requested by each preset listing them.
+var presetFields = map[FieldsPreset][]string{
+	FieldsMinimal:   {"summary", "status", "issuetype", "updated"},
+	FieldsReporting: {"summary", "status", "issuetype", "priority", "assignee", "reporter", "created", "updated", "resolutiondate", "labels"},
+}
+
+// UnknownFieldPolicy controls how requested fields that Jira does not know
+// are handled. Jira rejects a search requesting any of them, which would fail
+// the export over a single typo.
+type UnknownFieldPolicy int
+
+const (
+	// UnknownFieldsKeep requests the fields unchecked.
+	UnknownFieldsKeep UnknownFieldPolicy = iota
+	// UnknownFieldsDrop checks the fields before the first search and drops
+	// the unknown ones with a warning.
+	UnknownFieldsDrop
+	// UnknownFieldsFail checks the fields before the first search and fails
+	// the export, naming the unknown ones.
+	UnknownFieldsFail
+)
+
+// fieldValue renders the value found at path in fields as a single output
+// cell. Strings are written as-is, missing and null values as an empty string
+// and anything else as JSON.
+func fieldValue(fields map[string]interface{}, path string) string {
+	switch v := fieldAt(fields, path).(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		valueJSON, _ := json.Marshal(v)
+		return string(valueJSON)
+	}
+}
+
+// fieldAt returns the value found at the dotted path in fields, or nil. A
+// field named after the whole path, as left by FlattenFields, takes
+// precedence.
+func fieldAt(fields map[string]interface{}, path string) interface{} {
+	if value, ok := fields[path]; ok {
+		return value
+	}
+	var value interface{} = fields
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+	return value
+}
+
+// fieldNames returns the sorted union of the top-level field IDs of issues.
+func fieldNames(issues []JiraIssue) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, issue := range issues {
+		for name := range issue.Fields {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkFieldVisibility applies policy to the fields missing from some issues.
+func (e *exporter) checkFieldVisibility(issues []JiraIssue, policy MissingFieldPolicy) {
+	if policy == MissingFieldsIgnore {
+		return
+	}
+
+	var inconsistent []string
+	for _, name := range fieldNames(issues) {
+		missing := 0
+		for _, issue := range issues {
+			if _, ok := issue.Fields[name]; !ok {
+				missing++
+			}
+		}
+		if missing == 0 {
+			continue
+		}
+		inconsistent = append(inconsistent, name)
+		if policy == MissingFieldsWarn {
+			e.logger.Printf("Warning: field %s is missing from %d of %d issues, it may not be visible to the authenticated user", name, missing, len(issues))
+		}
+	}
+
+	if policy == MissingFieldsFill && len(inconsistent) > 0 {
+		e.logger.Printf("Filling fields missing from some issues: %s", strings.Join(inconsistent, ", "))
+		for i := range issues {
+			if issues[i].Fields == nil {
+				issues[i].Fields = make(map[string]interface{})
+			}
+			for _, name := range inconsistent {
+				if _, ok := issues[i].Fields[name]; !ok {
+					issues[i].Fields[name] = nil
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package camembert
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestNumbersKeepTheirPrecision(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{name: "large integer", value: "12345678901234567890"},
+		{name: "precise decimal", value: "0.12345678901234567890123"},
+		{name: "exponent", value: "1.5e+300"},
+		{name: "negative", value: "-9007199254740993"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			csvFile, dbFile := filepath.Join(dir, "issues.csv"), filepath.Join(dir, "issues.db")
+			cfg := (&fakeJira{total: 1, fields: map[string]json.RawMessage{"customfield_1": json.RawMessage(tt.value)}}).start(t)
+			cfg.CSV = &CSVOutput{File: csvFile, Fields: []FieldMapping{{Field: "customfield_1", Column: "number"}}}
+			cfg.DB = &DBOutput{File: dbFile, Table: "issues"}
+			if _, err := Export(context.Background(), cfg); err != nil {
+				t.Fatal(err)
+			}
+
+			data, _ := os.ReadFile(csvFile)
+			if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); lines[1] != "10000,P-0,"+tt.value {
+				t.Errorf("CSV row = %q, want the value %s", lines[1], tt.value)
+			}
+			db, err := sql.Open("sqlite3", dbFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			var fields string
+			if err := db.QueryRow("SELECT fields FROM issues").Scan(&fields); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(fields, `"customfield_1":`+tt.value) {
+				t.Errorf("DB fields = %s, want the value %s", fields, tt.value)
+			}
+		})
+	}
+}
+
+// fieldsJira records the fields requested by the searches of a fakeJira.
+type fieldsJira struct {
+	*fakeJira
+
+	mu     sync.Mutex
+	fields []string
+}
+
+func (f *fieldsJira) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/search") {
+		f.mu.Lock()
+		f.fields = append(f.fields, r.URL.Query().Get("fields"))
+		f.mu.Unlock()
+	}
+	f.fakeJira.ServeHTTP(w, r)
+}
+
+func TestExportSafetyFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		edit   func(cfg *Config)
+		fields string
+	}{
+		{name: "default", edit: func(cfg *Config) {}, fields: "customfield_1,summary,status,issuetype,created,updated"},
+		{name: "custom", edit: func(cfg *Config) { cfg.SafetyFields = []string{"status", "priority"} }, fields: "customfield_1,status,priority"},
+		{name: "none", edit: func(cfg *Config) { cfg.NoSafetyFields = true }, fields: "customfield_1"},
+		{name: "all fields", edit: func(cfg *Config) { cfg.CSV.Fields = nil }, fields: "*all"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jira := &fieldsJira{fakeJira: &fakeJira{total: 2}}
+			cfg := serve(t, jira)
+			cfg.CSV = &CSVOutput{File: filepath.Join(t.TempDir(), "issues.csv"), Fields: []FieldMapping{{Field: "customfield_1.value"}}}
+			tt.edit(&cfg)
+			if _, err := Export(context.Background(), cfg); err != nil {
+				t.Fatal(err)
+			}
+			jira.mu.Lock()
+			defer jira.mu.Unlock()
+			if len(jira.fields) == 0 {
+				t.Fatal("no search was requested")
+			}
+			for _, fields := range jira.fields {
+				if fields != tt.fields {
+					t.Errorf("requested fields %q, want %q", fields, tt.fields)
+				}
+			}
+		})
+	}
+}
+
+func TestExportFieldsPreset(t *testing.T) {
+	tests := []struct {
+		name   string
+		edit   func(cfg *Config)
+		fields string
+	}{
+		{name: "minimal", edit: func(cfg *Config) { cfg.FieldsPreset = FieldsMinimal }, fields: "summary,status,issuetype,updated,created"},
+		{name: "minimal with fields", edit: func(cfg *Config) {
+			cfg.FieldsPreset = FieldsMinimal
+			cfg.Fields = []string{"customfield_1"}
+			cfg.CSV = &CSVOutput{File: filepath.Join(t.TempDir(), "issues.csv"), Fields: []FieldMapping{{Field: "priority.name"}}}
+		}, fields: "summary,status,issuetype,updated,customfield_1,priority,created"},
+		{name: "reporting", edit: func(cfg *Config) {
+			cfg.FieldsPreset = FieldsReporting
+			cfg.NoSafetyFields = true
+		}, fields: "summary,status,issuetype,priority,assignee,reporter,created,updated,resolutiondate,labels"},
+		{name: "all", edit: func(cfg *Config) {
+			cfg.FieldsPreset = FieldsAll
+			cfg.Fields = []string{"customfield_1"}
+			cfg.CSV = &CSVOutput{File: filepath.Join(t.TempDir(), "issues.csv"), Fields: []FieldMapping{{Field: "summary"}}}
+		}, fields: "*all"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jira := &fieldsJira{fakeJira: &fakeJira{total: 2}}
+			cfg := serve(t, jira)
+			cfg.Writers = []Writer{&keyWriter{}}
+			tt.edit(&cfg)
+			if _, err := Export(context.Background(), cfg); err != nil {
+				t.Fatal(err)
+			}
+			jira.mu.Lock()
+			defer jira.mu.Unlock()
+			if len(jira.fields) == 0 {
+				t.Fatal("no search was requested")
+			}
+			for _, fields := range jira.fields {
+				if fields != tt.fields {
+					t.Errorf("requested fields %q, want %q", fields, tt.fields)
+				}
+			}
+		})
+	}
+}
@@ -2,4 +2,9 @@ module github.com/e6tUcu7c9h/camembert
 
 go 1.24
 
-require github.com/mattn/go-sqlite3 v1.14.28
+require (
+	github.com/mattn/go-sqlite3 v1.14.28
+	github.com/santhosh-tekuri/jsonschema/v6 v6.0.2
+)
+
+require golang.org/x/text v0.14.0 // indirect
@@ -0,0 +1,206 @@
+package camembert
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// jqlTimeLayout is the date format of JQL, interpreted by Jira in the time
+// zone of the authenticated user.
+const jqlTimeLayout = "2006-01-02 15:04"
+
+// jqlLocation returns the time zone JQL dates are written in: the one of
+// the authenticated user once loaded, the local one otherwise.
+func (c Config) jqlLocation() *time.Location {
+	if c.jqlZone != nil {
+		return c.jqlZone
+	}
+	return time.Local
+}
+
+// loadJQLZone loads the time zone of the authenticated user, in which Jira
+// reads the dates of JQL queries. The local time zone is kept, with a
+// warning, when it cannot be fetched.
+func (e *exporter) loadJQLZone(ctx context.Context) {
+	var myself struct {
+		TimeZone string `json:"timeZone"`
+	}
+	myselfURL := fmt.Sprintf("%s/rest/api/%d/myself", e.cfg.siteURL(), e.cfg.apiVersion())
+	if err := e.getJSON(ctx, myselfURL, nil, &myself); err != nil {
+		e.logger.Printf("Warning: failed to fetch the time zone of the Jira user, using the local time zone in JQL: %v", err)
+		return
+	}
+	zone, err := time.LoadLocation(myself.TimeZone)
+	if err != nil || myself.TimeZone == "" {
+		e.logger.Printf("Warning: unknown time zone %q of the Jira user, using the local time zone in JQL", myself.TimeZone)
+		return
+	}
+	e.cfg.jqlZone = zone
+}
+
+// searchJQL returns the JQL query of the issues exported from ProjectKey.
+func (c Config) searchJQL() string {
+	jql := fmt.Sprintf("project=%s", c.ProjectKey)
+	if !c.UpdatedSince.IsZero() {
+		jql += fmt.Sprintf(` AND updated >= "%s"`, c.UpdatedSince.In(c.jqlLocation()).Format(jqlTimeLayout))
+	}
+	if !c.createdUntil.IsZero() {
+		jql += fmt.Sprintf(` AND created < "%s"`, c.createdUntil.In(c.jqlLocation()).Format(jqlTimeLayout))
+	}
+	switch {
+	case c.Consistent:
+		jql += " ORDER BY created ASC, key ASC"
+	case c.Ordered:
+		jql += " ORDER BY key ASC"
+	}
+	return jql
+}
+
+// prepareQuery completes the selection of the issues exported from startedAt
+// on: it loads Config.Watermark, the time zone dates are written in and sets
+// the creation cutoff of Consistent.
+func (e *exporter) prepareQuery(ctx context.Context, startedAt time.Time) error {
+	if e.cfg.Watermark != nil {
+		if err := e.loadWatermark(); err != nil {
+			return err
+		}
+	}
+	if !e.cfg.UpdatedSince.IsZero() || e.cfg.Consistent {
+		e.loadJQLZone(ctx)
+	}
+	if e.cfg.Consistent {
+		e.cfg.createdUntil = startedAt
+		e.logger.Printf("Exporting issues created before %s", startedAt.In(e.cfg.jqlLocation()).Format(jqlTimeLayout))
+	}
+	return nil
+}
+
+// query describes the issues selected by c for error messages.
+func (c Config) query() string {
+	switch {
+	case c.Endpoint == EndpointServiceDesk:
+		return fmt.Sprintf("service desk %s", c.ServiceDeskID)
+	case len(c.IssueKeys) > 0:
+		return fmt.Sprintf("%d issue keys", len(c.IssueKeys))
+	}
+	return fmt.Sprintf("JQL %q", c.searchJQL())
+}
+
+// issueChangelog is the changelog returned with an issue by expand=changelog.
+type issueChangelog struct {
+	MaxResults int `json:"maxResults"`
+	Total      int `json:"total"`
+	Histories  []struct {
+		Created string `json:"created"`
+		Items   []struct {
+			FieldID string `json:"fieldId"`
+		} `json:"items"`
+	} `json:"histories"`
+}
+
+// changedFields returns the IDs of the fields changed since since according
+// to the changelog of issue. It reports false when the changelog cannot
+// tell, because it is missing, truncated or lacks field IDs.
+func changedFields(issue JiraIssue, since time.Time) ([]string, bool) {
+	raw, ok := issue.Expanded["changelog"]
+	if !ok {
+		return nil, false
+	}
+	var changelog issueChangelog
+	if err := decodeJSON(raw, &changelog); err != nil || changelog.Total > len(changelog.Histories) {
+		return nil, false
+	}
+
+	var fields []string
+	seen := make(map[string]bool)
+	for _, history := range changelog.Histories {
+		created, err := time.Parse(jiraTimeLayout, history.Created)
+		if err != nil {
+			return nil, false
+		}
+		if created.Before(since) {
+			continue
+		}
+		for _, item := range history.Items {
+			if item.FieldID == "" {
+				return nil, false
+			}
+			if !seen[item.FieldID] {
+				seen[item.FieldID] = true
+				fields = append(fields, item.FieldID)
+			}
+		}
+	}
+	return fields, true
+}
+
+// requestedFields returns the fields of changed selected by requested, the
+// fields parameter of searches. Selectors such as *all and *navigable are
+// taken to select every field but the ones excluded with a leading -.
+func requestedFields(changed []string, requested string) []string {
+	all := false
+	selected := make(map[string]bool)
+	excluded := make(map[string]bool)
+	for _, name := range strings.Split(requested, ",") {
+		switch {
+		case strings.HasPrefix(name, "*"):
+			all = true
+		case strings.HasPrefix(name, "-"):
+			excluded[name[1:]] = true
+		default:
+			selected[name] = true
+		}
+	}
+	var fields []string
+	for _, name := range changed {
+		if (all || selected[name]) && !excluded[name] {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
+
+// changedFieldsSource pages through the issues updated since
+// Config.UpdatedSince with their changelog only, then fetches each issue
+// with the requested fields its changelog reports as changed, or with every
+// requested field when the changelog cannot tell.
+type changedFieldsSource struct{}
+
+func (changedFieldsSource) fetchPage(ctx context.Context, e *exporter, startAt int) (JiraResponse, error) {
+	resp, err := searchPage(ctx, e, e.cfg.searchJQL(), startAt, "updated", []string{"changelog"})
+	if err != nil {
+		return JiraResponse{}, err
+	}
+	for i, issue := range resp.Issues {
+		fields := e.fields
+		if changed, ok := changedFields(issue, e.cfg.UpdatedSince); ok {
+			fields = strings.Join(append(requestedFields(changed, e.fields), "updated"), ",")
+		}
+		full, err := e.fetchIssue(ctx, issue.Key, fields)
+		if err != nil {
+			return JiraResponse{}, fmt.Errorf("failed to fetch issue %s: %w", issue.Key, err)
+		}
+		resp.Issues[i] = full
+	}
+	return resp, nil
+}
+
+// fetchIssue fetches a single issue with the given fields.
+func (e *exporter) fetchIssue(ctx context.Context, key string, fields string) (JiraIssue, error) {
+	q := url.Values{}
+	q.Set("fields", fields)
+	if len(e.cfg.Expand) > 0 {
+		q.Set("expand", strings.Join(e.cfg.Expand, ","))
+	}
+	var issue JiraIssue
+	issueURL := fmt.Sprintf("%s/rest/api/%d/issue/%s", e.cfg.siteURL(), e.cfg.apiVersion(), url.PathEscape(key))
+	if err := e.getJSON(ctx, issueURL, q, &issue); err != nil {
+		return JiraIssue{}, err
+	}
+	issues := []JiraIssue{issue}
+	e.stampProvenance(issues, issueURL, q)
+	return issues[0], nil
+}
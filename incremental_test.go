@@ -0,0 +1,55 @@
+package camembert
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestedFields(t *testing.T) {
+	tests := []struct {
+		name      string
+		changed   []string
+		requested string
+		want      []string
+	}{
+		{name: "narrowed", changed: []string{"summary", "labels", "customfield_1"}, requested: "summary,status,customfield_1", want: []string{"summary", "customfield_1"}},
+		{name: "none requested", changed: []string{"labels"}, requested: "summary,status"},
+		{name: "all", changed: []string{"summary", "labels"}, requested: "*all", want: []string{"summary", "labels"}},
+		{name: "all but excluded", changed: []string{"summary", "comment"}, requested: "*all,-comment", want: []string{"summary"}},
+		{name: "no change", requested: "summary"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := requestedFields(tt.changed, tt.requested); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("requestedFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChangedFieldsOnlyRequiresDBAppend(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{name: "CSV", cfg: Config{CSV: &CSVOutput{File: "issues.csv"}}, wantErr: true},
+		{name: "DB", cfg: Config{DB: &DBOutput{File: "issues.db", Table: "issues"}}, wantErr: true},
+		{name: "DB appended to", cfg: Config{DB: &DBOutput{File: "issues.db", Table: "issues", Append: true}}},
+		{name: "every output appended to", cfg: Config{DB: &DBOutput{File: "issues.db", Table: "issues"}, OnExisting: ExistingAppend}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.JiraBaseURL, cfg.ProjectKey = "http://jira.example.com/rest/api/2/search", "P"
+			cfg.UpdatedSince = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+			cfg.ChangedFieldsOnly = true
+			err := cfg.Validate()
+			if gotErr := err != nil && strings.Contains(err.Error(), "ChangedFieldsOnly requires the DB output"); gotErr != tt.wantErr || (err != nil && !gotErr) {
+				t.Errorf("Validate() error = %v, want the DB output required: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package camembert
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Policy selects how an anomaly in the fetched issues is handled.
+type Policy int
+
+const (
+	// PolicyWarn logs a warning and keeps the issue.
+	PolicyWarn Policy = iota
+	// PolicySkip logs a warning and drops the issue.
+	PolicySkip
+	// PolicyFail aborts the export.
+	PolicyFail
+)
+
+// DuplicatePolicy selects how an issue returned more than once by a single
+// export, for example after pagination drift, is handled. It applies to every
+// output alike.
+type DuplicatePolicy int
+
+const (
+	// DuplicatesKeepFirst writes the first copy of an issue and drops the
+	// later ones.
+	DuplicatesKeepFirst DuplicatePolicy = iota
+	// DuplicatesKeepLast writes the last copy of an issue, at the position
+	// of that copy. It needs every issue and cannot be streamed.
+	DuplicatesKeepLast
+	// DuplicatesError aborts the export.
+	DuplicatesError
+)
+
+// apply handles an anomaly described by msg according to p. It reports
+// whether the issue should be kept, or an error if the export must stop.
+func (e *exporter) apply(p Policy, msg string) (bool, error) {
+	switch p {
+	case PolicyFail:
+		return false, errors.New(msg)
+	case PolicySkip:
+		e.logger.Printf("Warning: %s, skipping it", msg)
+		e.stats.skipped.Add(1)
+		return false, nil
+	default:
+		e.logger.Printf("Warning: %s", msg)
+		return true, nil
+	}
+}
+
+// checkSchemas validates issue against the configured schemas. It reports
+// whether the issue should be kept, or an error if the export must stop.
+func (e *exporter) checkSchemas(issue JiraIssue) (bool, error) {
+	for _, schema := range e.schemas {
+		if err := schema.validate(issue); err != nil {
+			subject := "fields"
+			if schema.check.Field != "" {
+				subject = schema.check.Field
+			}
+			keep, err := e.apply(schema.check.Policy, fmt.Sprintf("issue %s fails schema validation of %s: %v", issue.Key, subject, err))
+			if err != nil || !keep {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+// checkIssues applies the configured policies to issues and returns the ones
+// to write.
+func (e *exporter) checkIssues(issues []JiraIssue) ([]JiraIssue, error) {
+	kept := issues[:0]
+	for _, issue := range issues {
+		if issue.Key == "" {
+			keep, err := e.apply(e.cfg.EmptyKey, fmt.Sprintf("issue with id %q has no key", issue.ID))
+			if err != nil {
+				return nil, err
+			}
+			if !keep {
+				continue
+			}
+		}
+		if issue.ID == "" {
+			keep, err := e.apply(e.cfg.EmptyID, fmt.Sprintf("issue %s has no id", issue.Key))
+			if err != nil {
+				return nil, err
+			}
+			if !keep {
+				continue
+			}
+			if issue.Key != "" {
+				issue.ID = issue.Key
+			}
+		}
+		keep, err := e.checkSchemas(issue)
+		if err != nil {
+			return nil, err
+		}
+		if !keep {
+			continue
+		}
+		kept = append(kept, issue)
+	}
+	return kept, nil
+}
+
+// issueID identifies an issue for duplicate detection.
+func issueID(issue JiraIssue) string {
+	if issue.ID != "" {
+		return issue.ID
+	}
+	return issue.Key
+}
+
+// dropDuplicates applies the duplicate policy to issues, which are compared
+// with each other and with the issues of previous batches.
+func (e *exporter) dropDuplicates(issues []JiraIssue) ([]JiraIssue, error) {
+	last := make(map[string]int)
+	if e.cfg.Duplicates == DuplicatesKeepLast {
+		for i, issue := range issues {
+			last[issueID(issue)] = i
+		}
+	}
+
+	kept := issues[:0]
+	for i, issue := range issues {
+		id := issueID(issue)
+		duplicate := e.seen[id]
+		if e.cfg.Duplicates == DuplicatesKeepLast {
+			duplicate = last[id] != i
+		}
+		if !duplicate {
+			e.seen[id] = true
+			kept = append(kept, issue)
+			continue
+		}
+		if e.cfg.Duplicates == DuplicatesError {
+			return nil, fmt.Errorf("issue %s returned more than once", issue.Key)
+		}
+		e.stats.duplicates.Add(1)
+	}
+	if dropped := len(issues) - len(kept); dropped > 0 {
+		e.logger.Printf("Dropped %d duplicate issues", dropped)
+	}
+	return kept, nil
+}
@@ -0,0 +1,187 @@
+package camembert
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestEmptyIDNotCollapsed(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      Policy
+		wantErr     bool
+		wantIDs     []string
+		wantSkipped int
+	}{
+		{name: "warn", policy: PolicyWarn, wantIDs: []string{"10000", "10004", "P-1", "P-2", "P-3"}},
+		{name: "skip", policy: PolicySkip, wantIDs: []string{"10000", "10004"}, wantSkipped: 3},
+		{name: "fail", policy: PolicyFail, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "issues.db")
+			jira := &fakeJira{total: 5, edit: func(i int, issue map[string]interface{}) {
+				if i >= 1 && i <= 3 {
+					delete(issue, "id")
+				}
+			}}
+			cfg := jira.start(t)
+			cfg.DB = &DBOutput{File: file, Table: "issues"}
+			cfg.EmptyID = tt.policy
+			result, err := Export(context.Background(), cfg)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "has no id") {
+					t.Errorf("Export() error = %v, want the missing id reported", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Skipped != tt.wantSkipped {
+				t.Errorf("Skipped = %d, want %d", result.Skipped, tt.wantSkipped)
+			}
+
+			db, err := sql.Open("sqlite3", file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			rows, err := db.Query("SELECT id FROM issues ORDER BY id")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+			var ids []string
+			for rows.Next() {
+				var id string
+				if err := rows.Scan(&id); err != nil {
+					t.Fatal(err)
+				}
+				ids = append(ids, id)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("stored ids = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestSchemas(t *testing.T) {
+	tests := []struct {
+		name        string
+		check       SchemaCheck
+		wantErr     string
+		wantKeys    []string
+		wantSkipped int
+	}{
+		{name: "warn", check: SchemaCheck{Schema: []byte(`{"type": "number"}`), Field: "customfield_1", Policy: PolicyWarn}, wantKeys: []string{"P-0", "P-1", "P-2", "P-3"}},
+		{name: "skip", check: SchemaCheck{Schema: []byte(`{"type": "number"}`), Field: "customfield_1", Policy: PolicySkip}, wantKeys: []string{"P-0", "P-2"}, wantSkipped: 2},
+		{name: "fail", check: SchemaCheck{Schema: []byte(`{"type": "number"}`), Field: "customfield_1", Policy: PolicyFail}, wantErr: "fails schema validation of customfield_1"},
+		{name: "fields", check: SchemaCheck{Schema: []byte(`{"properties": {"customfield_1": {"type": "number"}}, "required": ["summary"]}`), Policy: PolicySkip}, wantKeys: []string{"P-0", "P-2"}, wantSkipped: 2},
+		{name: "invalid schema", check: SchemaCheck{Schema: []byte(`{"type": `)}, wantErr: "invalid JSON"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jira := &fakeJira{total: 4, edit: func(i int, issue map[string]interface{}) {
+				value := interface{}(i)
+				if i%2 == 1 {
+					value = "not a number"
+				}
+				issue["fields"].(map[string]interface{})["customfield_1"] = value
+			}}
+			cfg := jira.start(t)
+			writer := &keyWriter{}
+			cfg.Writers = []Writer{writer}
+			cfg.Schemas = []SchemaCheck{tt.check}
+			result, err := Export(context.Background(), cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Export() error = %v, want %q", err, tt.wantErr)
+				}
+				if len(writer.keys) != 0 {
+					t.Errorf("wrote %v, want nothing", writer.keys)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Skipped != tt.wantSkipped {
+				t.Errorf("Skipped = %d, want %d", result.Skipped, tt.wantSkipped)
+			}
+			sort.Strings(writer.keys)
+			if !reflect.DeepEqual(writer.keys, tt.wantKeys) {
+				t.Errorf("wrote %v, want %v", writer.keys, tt.wantKeys)
+			}
+		})
+	}
+}
+
+func TestDuplicates(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  DuplicatePolicy
+		wantErr bool
+		// want lists the summaries written, in order.
+		want []string
+	}{
+		{name: "keep first", policy: DuplicatesKeepFirst, want: []string{"issue 0", "issue 1", "issue 2", "issue 4"}},
+		{name: "keep last", policy: DuplicatesKeepLast, want: []string{"issue 0", "issue 2", "issue 3", "issue 4"}},
+		{name: "error", policy: DuplicatesError, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The issue at index 3 is a second copy of P-1.
+			jira := &fakeJira{total: 5, edit: func(i int, issue map[string]interface{}) {
+				if i == 3 {
+					issue["id"], issue["key"] = "10001", "P-1"
+				}
+			}}
+			cfg := jira.start(t)
+			file := filepath.Join(t.TempDir(), "issues.csv")
+			cfg.CSV = &CSVOutput{File: file, Fields: []FieldMapping{{Field: "summary"}}}
+			writer := &issueWriter{}
+			cfg.Writers = []Writer{writer}
+			cfg.Duplicates = tt.policy
+			result, err := Export(context.Background(), cfg)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "issue P-1 returned more than once") {
+					t.Errorf("Export() error = %v, want the duplicate reported", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Duplicates != 1 || result.Written != 4 {
+				t.Errorf("result = %+v, want 4 issues written and 1 duplicate", result)
+			}
+
+			var written []string
+			for _, issue := range writer.issues {
+				written = append(written, issue.Fields["summary"].(string))
+			}
+			if !reflect.DeepEqual(written, tt.want) {
+				t.Errorf("wrote %v to the writer, want %v", written, tt.want)
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var rows []string
+			for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n")[1:] {
+				rows = append(rows, line[strings.LastIndex(line, ",")+1:])
+			}
+			if !reflect.DeepEqual(rows, tt.want) {
+				t.Errorf("wrote %v to the CSV file, want %v", rows, tt.want)
+			}
+		})
+	}
+}
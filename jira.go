@@ -1,203 +1,795 @@
 package camembert
 
 import (
+	"context"
 	"database/sql"
-	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
-	"os"
-	"strconv"
 	"sync"
-
-	_ "github.com/mattn/go-sqlite3"
+	"time"
 )
 
 // TODO: Run DLL after database initialization
-// TODO: Configuration schema validation
 // TODO: Docstrings
 
 const (
 	pageSize = 1000
+	// numWorkers is the number of goroutines fetching pages.
+	numWorkers = 12
+	// streamInFlight is the number of pages in flight when streaming
+	// without Config.MaxInFlight: every worker fetching one page while
+	// another one waits to be written.
+	streamInFlight = 2 * numWorkers
 )
 
 type JiraResponse struct {
 	Issues []JiraIssue `json:"issues"`
-	Total  int         `json:"total"`
+	// Total is the number of issues matched, or -1 when the endpoint does
+	// not report it.
+	Total int `json:"total"`
+	// MaxResults is the page size applied by Jira, which silently lowers
+	// the requested one to its configured ceiling. Zero when not reported.
+	MaxResults int `json:"maxResults"`
+
+	// last is set when the endpoint reports this page as the final one.
+	last bool
+	// startAt is the offset the page was requested at.
+	startAt int
+	// failed marks a page whose fetch failed, which holds no issues.
+	failed bool
 }
 
 type JiraIssue struct {
-	ID     string                 `json:"id"`
-	Key    string                 `json:"key"`
+	ID  string `json:"id"`
+	Key string `json:"key"`
+	// Fields holds the decoded fields of the issue. Numbers are json.Number
+	// values rather than float64, so they are never rounded.
 	Fields map[string]interface{} `json:"fields"`
+
+	// Expanded holds the issue properties requested with Config.Expand, such
+	// as editmeta or operations, keyed by name and kept as returned by Jira.
+	Expanded map[string]json.RawMessage `json:"-"`
+
+	// FieldsJSON holds the encoded Fields when a writer asks for them with
+	// FieldsEncoded.
+	FieldsJSON json.RawMessage `json:"-"`
+
+	// EpicKey and EpicSummary describe the epic of the issue when
+	// Config.Epics is set.
+	EpicKey     string `json:"-"`
+	EpicSummary string `json:"-"`
+
+	// SourceURL and FetchedAt record the request the issue was fetched with
+	// and the time of its response when Config.Provenance is set.
+	SourceURL string    `json:"-"`
+	FetchedAt time.Time `json:"-"`
+
+	// apiVersion is the API version the issue was fetched with.
+	apiVersion APIVersion
+	// rawFields holds the fields as returned by Jira when
+	// Config.PreserveFieldOrder is set.
+	rawFields json.RawMessage
 }
 
-func fetchIssues(jiraBaseURL, projectKey string, headers map[string]string, startAt int) (JiraResponse, error) {
-	log.Printf("Fetching issues from %d", startAt)
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", jiraBaseURL, nil)
-	if err != nil {
-		return JiraResponse{}, err
+// UnmarshalJSON decodes an issue, keeping the properties returned besides
+// its id, key and fields in Expanded.
+func (i *JiraIssue) UnmarshalJSON(data []byte) error {
+	var properties map[string]json.RawMessage
+	if err := json.Unmarshal(data, &properties); err != nil {
+		return err
 	}
-
-	// Set headers for authentication
-	for name, value := range headers {
-		req.Header.Set(name, value)
+	*i = JiraIssue{}
+	for name, value := range properties {
+		var err error
+		switch name {
+		case "id":
+			err = decodeJSON(value, &i.ID)
+		case "key":
+			err = decodeJSON(value, &i.Key)
+		case "fields":
+			err = decodeJSON(value, &i.Fields)
+			i.rawFields = value
+		case "self", "expand":
+		default:
+			if i.Expanded == nil {
+				i.Expanded = make(map[string]json.RawMessage)
+			}
+			i.Expanded[name] = value
+		}
+		if err != nil {
+			return fmt.Errorf("invalid issue %s: %w", name, err)
+		}
 	}
+	return nil
+}
 
-	// Set query parameters
-	q := req.URL.Query()
-	q.Add("jql", fmt.Sprintf("project=%s", projectKey))
-	q.Add("startAt", strconv.Itoa(startAt))
-	q.Add("maxResults", strconv.Itoa(pageSize))
-	q.Add("fields", "*all")
-	req.URL.RawQuery = q.Encode()
+// exporter holds the state shared by the goroutines of a single export run.
+type exporter struct {
+	cfg       Config
+	client    *http.Client
+	logger    *log.Logger
+	requestID string
+	source    pageSource
+
+	// lastPage is closed once a page reported as the final one is fetched.
+	lastPage     chan struct{}
+	lastPageOnce sync.Once
+	// stride is the offset between two pages, the page size applied by Jira
+	// to the first page. It is set before the other pages are requested.
+	stride int
+	// bounds tracks whether pages were lost to Config.MaxDuration.
+	bounds pageBounds
+	// inFlight holds a slot per page fetched but not yet written when
+	// Config.MaxInFlight is set or pages are streamed.
+	inFlight chan struct{}
+	// users collects the users referenced by written issues.
+	users userSet
+	// sprints collects the sprints of written issues. sprintFieldsWarned is
+	// set once an issue holding sprints in several fields is reported.
+	sprints            []issueSprint
+	sprintFieldsWarned bool
+	// csvStream is CSVOutput.Writer until the CSV writer takes it over.
+	csvStream io.WriteCloser
+	// tuner limits the concurrent page requests with
+	// Config.AutoConcurrency.
+	tuner *concurrencyTuner
+	// stages is the pipeline every batch goes through before being written.
+	stages []Stage
+	// children collects the labels and components of written issues.
+	children []issueChildren
+	// visibility collects the visibility of the comments and worklogs of
+	// written issues.
+	visibility []itemVisibility
+	// observedFields holds the IDs of the fields of written issues, and
+	// snapshot lists them once written, with Config.FieldSnapshot.
+	observedFields map[string]bool
+	snapshot       []ManifestField
+	// profile accumulates the profile of the columns of written issues, and
+	// profiled counts them, with Config.ProfileFile.
+	profile  []*columnStats
+	profiled int
+	// seen holds the IDs of the issues written so far.
+	seen map[string]bool
+	// epics caches the summaries of the epics of written issues.
+	epics epicSummaries
+	// fields is the value of the fields query parameter of searches.
+	fields string
+	// jiraFields caches the fields described by the field endpoint.
+	jiraFields []jiraField
+	// fieldNames maps field IDs to their names when CSVOutput.FieldNames is
+	// set and they could be fetched.
+	fieldNames map[string]string
+	// pages records every page request when diagnostics are enabled.
+	pages *pageLog
+	// schemas validates issues before they are written.
+	schemas []compiledSchema
+	// memDB is the database built for DBOutput.Writer. memDBUsed is set
+	// once it has been opened, so that a discarded one is not recreated.
+	memDB     *sql.DB
+	memDBUsed bool
+	// dbUnlocks unlocks the database files opened by openDB.
+	dbUnlocks map[*sql.DB]func()
+	// events delivers the retry and rate limit callbacks.
+	events *eventQueue
+	stats  exportStats
+}
+
+func newExporter(ctx context.Context, cfg Config) *exporter {
+	requestID := cfg.RequestID
+	if requestID == "" {
+		requestID = RequestIDFromContext(ctx)
+	}
+	logger := log.Default()
+	if requestID != "" {
+		logger = log.New(log.Writer(), fmt.Sprintf("[%s] ", requestID), log.Flags()|log.Lmsgprefix)
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{}
+	}
+	e := &exporter{
+		cfg:       cfg,
+		client:    client,
+		logger:    logger,
+		requestID: requestID,
+		source:    cfg.source(),
+		fields:    cfg.fetchFields(),
+		lastPage:  make(chan struct{}),
+		dbUnlocks: make(map[*sql.DB]func()),
+		seen:      make(map[string]bool),
+		bounds:    pageBounds{last: -1, lost: -1},
+	}
+	if cfg.Users != nil {
+		e.users = make(userSet)
+	}
+	if cfg.Diagnostics != nil {
+		e.pages = &pageLog{}
+	}
+	if cfg.Epics != nil {
+		e.epics = make(epicSummaries)
+	}
+	if cfg.FieldSnapshot != nil {
+		e.observedFields = make(map[string]bool)
+	}
+	if cfg.ProfileFile != "" {
+		e.profile = newColumnStats(cfg.profileMappings())
+	}
+	if cfg.CSV != nil {
+		e.csvStream = cfg.CSV.Writer
+	}
+	if cfg.AutoConcurrency {
+		e.tuner = newConcurrencyTuner(logger, numWorkers)
+	}
+	e.stages = e.pipeline()
+	return e
+}
 
-	// Send request
-	resp, err := client.Do(req)
+func (e *exporter) fetchIssues(ctx context.Context, startAt int) (JiraResponse, error) {
+	resp, err := e.fetchRecordedPage(ctx, startAt)
 	if err != nil {
 		return JiraResponse{}, err
 	}
-	defer resp.Body.Close()
+	if e.stride > 0 && resp.MaxResults > 0 && resp.MaxResults < e.stride {
+		e.logger.Printf("Warning: page at startAt %d was limited to %d issues, below the %d of the first page, issues may be missing", startAt, resp.MaxResults, e.stride)
+	}
+	if e.stride > 0 && resp.Total >= 0 && !resp.last {
+		e.fillPage(ctx, startAt, &resp)
+	}
+	version := e.cfg.apiVersion()
+	for i := range resp.Issues {
+		resp.Issues[i].apiVersion = version
+		if !e.cfg.PreserveFieldOrder {
+			resp.Issues[i].rawFields = nil
+		}
+	}
+	resp.startAt = startAt
+	if resp.last {
+		e.bounds.markLast(startAt)
+		e.lastPageOnce.Do(func() { close(e.lastPage) })
+	}
+	return resp, nil
+}
 
-	// Decode the response
-	var jiraResponse JiraResponse
-	if err := json.NewDecoder(resp.Body).Decode(&jiraResponse); err != nil {
+// fetchRecordedPage fetches the page at startAt, counting it and recording it
+// in the diagnostics.
+func (e *exporter) fetchRecordedPage(ctx context.Context, startAt int) (JiraResponse, error) {
+	e.logger.Printf("Fetching issues from %d", startAt)
+	resp, err := e.fetchPageWithRetries(ctx, startAt)
+	if e.pages != nil {
+		record := pageRecord{startAt: startAt, requested: pageSize, returned: len(resp.Issues), total: resp.Total, err: err}
+		if err == nil {
+			record.applied = resp.MaxResults
+		}
+		e.pages.add(record)
+	}
+	if err != nil {
+		e.stats.failedPages.Add(1)
+		if ctx.Err() != nil {
+			e.bounds.markLost(startAt)
+		}
 		return JiraResponse{}, err
 	}
+	e.stats.pages.Add(1)
+	return resp, nil
+}
 
-	return jiraResponse, nil
+// fillPage completes a page holding fewer issues than the stride although
+// more issues follow it, as returned when Jira caps a page below the size it
+// reports or when issues leave the results during the export. The missing
+// issues are requested from the end of the page, so that none is skipped
+// before the next page.
+func (e *exporter) fillPage(ctx context.Context, startAt int, resp *JiraResponse) {
+	want := min(e.stride, resp.Total-startAt)
+	for len(resp.Issues) < want {
+		offset := startAt + len(resp.Issues)
+		e.logger.Printf("Warning: page at startAt %d holds %d of %d issues, requesting the rest", startAt, len(resp.Issues), want)
+		more, err := e.fetchRecordedPage(ctx, offset)
+		if err != nil {
+			e.logger.Printf("Error fetching issues at startAt %d: %v", offset, err)
+			return
+		}
+		if len(more.Issues) == 0 {
+			return
+		}
+		resp.Issues = append(resp.Issues, more.Issues[:min(len(more.Issues), want-len(resp.Issues))]...)
+	}
 }
 
-func saveIssuesToCSV(issues []JiraIssue, csvFile string) error {
-	log.Printf("Saving issues to CSV file: %s", csvFile)
-	file, err := os.Create(csvFile)
-	if err != nil {
+// write passes a batch of issues through the pipeline and hands the remaining
+// ones to writers.
+func (e *exporter) write(ctx context.Context, writers *writerGroup, issues []JiraIssue) error {
+	stageCtx := context.WithValue(ctx, exporterKey{}, e)
+	for _, stage := range e.stages {
+		var err error
+		if issues, err = stage(stageCtx, issues); err != nil {
+			return err
+		}
+	}
+	if err := writers.write(ctx, issues); err != nil {
 		return err
 	}
-	defer file.Close()
+	e.stats.written.Add(int64(len(issues)))
+	return nil
+}
+
+// worker fetches the pages sent on jobs, after waiting for delay so that
+// workers can be started gradually.
+func (e *exporter) worker(ctx context.Context, wg *sync.WaitGroup, delay time.Duration, jobs <-chan int, results chan<- JiraResponse) {
+	defer wg.Done()
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+	for startAt := range jobs {
+		jiraResp, err := e.fetchIssues(ctx, startAt)
+		if err != nil {
+			e.logger.Printf("Error fetching issues at startAt %d: %v", startAt, err)
+			results <- JiraResponse{startAt: startAt, failed: true}
+			continue
+		}
+		results <- jiraResp
+	}
+}
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+// pageBounds records the offset of the page reported as the last one and the
+// lowest offset of a page whose fetch was cancelled, each -1 until known.
+// Pages requested ahead past the last one may be cancelled without loss.
+type pageBounds struct {
+	mu   sync.Mutex
+	last int
+	lost int
+}
 
-	// Write CSV headers
-	headers := []string{"ID", "Key", "Fields"}
-	if err := writer.Write(headers); err != nil {
-		log.Fatalf("Failed to write CSV headers: %v", err)
-		return err
+func (b *pageBounds) markLast(startAt int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.last < 0 || startAt < b.last {
+		b.last = startAt
 	}
+}
 
-	// Write issue data
-	for _, issue := range issues {
-		fieldsJSON, _ := json.Marshal(issue.Fields)
-		record := []string{issue.ID, issue.Key, string(fieldsJSON)}
-		if err := writer.Write(record); err != nil {
-			log.Fatalf("Failed to write data in CSV file: %v", err)
-			return err
-		}
+func (b *pageBounds) markLost(startAt int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.lost < 0 || startAt < b.lost {
+		b.lost = startAt
 	}
-	return nil
 }
 
-func saveIssuesToDB(issues []JiraIssue, dbFile string, tableName string) error {
-	log.Printf("Saving issues to DB file %s in table %s.", dbFile, tableName)
+// truncated reports whether a page before the last one was cancelled.
+func (b *pageBounds) truncated() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lost >= 0 && (b.last < 0 || b.lost < b.last)
+}
 
-	db, err := sql.Open("sqlite3", dbFile)
+// acquire blocks until another page may be in flight, that is fetched but
+// not yet written, and reports false if ctx is done first. release frees the
+// slot of a written or failed page.
+func (e *exporter) acquire(ctx context.Context) bool {
+	if e.inFlight == nil {
+		return ctx.Err() == nil
+	}
+	select {
+	case e.inFlight <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (e *exporter) release() {
+	if e.inFlight != nil {
+		<-e.inFlight
+	}
+}
+
+// ExportIssues exports every issue of a project to both a CSV file and an
+// SQLite table. It is a shorthand for Export and exits the process on failure.
+func ExportIssues(jiraBaseURL string, headers map[string]string, dbFile string, projectKey string, csvFile string, tableName string) {
+	cfg := Config{
+		JiraBaseURL: jiraBaseURL,
+		Headers:     headers,
+		ProjectKey:  projectKey,
+		CSV:         &CSVOutput{File: csvFile},
+		DB:          &DBOutput{File: dbFile, Table: tableName, Append: true},
+		OnExisting:  ExistingOverwrite,
+	}
+	if _, err := Export(context.Background(), cfg); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Export fetches the issues described by cfg and writes them to each
+// configured output. Requests are sent with ctx, and log lines carry the
+// request ID from cfg or ctx when one is set.
+func Export(ctx context.Context, cfg Config) (ExportResult, error) {
+	startedAt := time.Now()
+	e := newExporter(ctx, cfg)
+	if err := cfg.validate(e.logger); err != nil {
+		err = fmt.Errorf("invalid configuration: %w", err)
+		e.discardCSVStream(err)
+		return ExportResult{}, err
+	}
+	schemas, err := compileSchemas(cfg.Schemas)
 	if err != nil {
-		log.Fatalf("Failed to open database file: %v", err)
-		return err
+		err = fmt.Errorf("invalid configuration: %w", err)
+		e.discardCSVStream(err)
+		return ExportResult{}, err
+	}
+	e.schemas = schemas
+	if err := e.prepareQuery(ctx, startedAt); err != nil {
+		e.discardCSVStream(err)
+		return ExportResult{}, err
+	}
+
+	e.events = newEventQueue()
+	err = e.run(ctx, startedAt)
+	e.stats.concurrency.Store(numWorkers)
+	if e.tuner != nil {
+		concurrency := e.tuner.concurrency()
+		e.logger.Printf("Settled on a concurrency of %d", concurrency)
+		e.stats.concurrency.Store(int64(concurrency))
+	}
+	if err != nil {
+		e.discardCSVStream(err)
 	}
-	defer db.Close()
+	e.events.close()
+	return e.stats.result(), err
+}
 
-	// Create table if it doesn't exist
-	createTableSQL := fmt.Sprintf(`
-	CREATE TABLE IF NOT EXISTS %s (
-		id TEXT PRIMARY KEY,
-		key TEXT,
-		fields TEXT
-	);`, tableName)
-	_, err = db.Exec(createTableSQL)
+func (e *exporter) run(ctx context.Context, startedAt time.Time) error {
+	cfg := e.cfg
+	defer e.closeMemDB()
+	var deadline time.Time
+	if cfg.MaxDuration > 0 {
+		deadline = startedAt.Add(cfg.MaxDuration)
+	}
+	err := e.export(ctx, deadline)
+	if cfg.Diagnostics != nil {
+		// Diagnostics are written for failed exports too, which is when
+		// they are most useful.
+		if diagErr := e.exportDiagnostics(*cfg.Diagnostics); diagErr != nil {
+			e.logger.Printf("Failed to save pagination diagnostics: %v", diagErr)
+		}
+	}
 	if err != nil {
-		log.Fatalf("Failed to create the table in the database: %v", err)
 		return err
 	}
 
-	// Insert issues into the table
-	insertSQL := fmt.Sprintf(`INSERT OR REPLACE INTO %s (id, key, fields) VALUES (?, ?, ?)`, tableName)
-	for _, issue := range issues {
-		fieldsJSON, _ := json.Marshal(issue.Fields)
-		_, err = db.Exec(insertSQL, issue.ID, issue.Key, string(fieldsJSON))
-		if err != nil {
-			log.Fatalf("Could not insert values in the table: %v", err)
+	if cfg.Users != nil {
+		usersCtx := ctx
+		if !deadline.IsZero() {
+			var cancel context.CancelFunc
+			usersCtx, cancel = context.WithDeadline(ctx, deadline)
+			defer cancel()
+		}
+		if err := e.exportUsers(usersCtx, *cfg.Users); err != nil {
+			return fmt.Errorf("failed to export users: %w", err)
+		}
+	}
+
+	if cfg.Sprints != nil {
+		if err := e.exportSprints(*cfg.Sprints); err != nil {
+			return fmt.Errorf("failed to export sprints: %w", err)
+		}
+	}
+
+	if cfg.ChildTables != nil {
+		if err := e.saveChildTables(*cfg.ChildTables, cfg.DB.File); err != nil {
+			return fmt.Errorf("failed to save child tables: %w", err)
+		}
+	}
+
+	if cfg.Visibility != nil {
+		if err := e.exportVisibility(*cfg.Visibility); err != nil {
+			return fmt.Errorf("failed to export visibility: %w", err)
+		}
+	}
+
+	if cfg.FieldDefinitions != nil {
+		if err := e.exportFieldDefinitions(ctx, *cfg.FieldDefinitions); err != nil {
+			return fmt.Errorf("failed to export field definitions: %w", err)
+		}
+	}
+
+	if cfg.FieldSnapshot != nil {
+		e.snapshot = e.snapshotFields(ctx)
+		if cfg.FieldSnapshot.Table != "" {
+			if err := e.saveFieldSnapshotToDB(startedAt, cfg.DB.File, cfg.FieldSnapshot.Table); err != nil {
+				return fmt.Errorf("failed to save field snapshot: %w", err)
+			}
+		}
+	}
+
+	if cfg.ProfileFile != "" {
+		if err := e.saveProfile(cfg.ProfileFile); err != nil {
+			return fmt.Errorf("failed to save column profile: %w", err)
+		}
+	}
+
+	if e.memDB != nil {
+		if err := e.dumpMemDB(ctx); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Checksums || cfg.ManifestFile != "" {
+		if err := e.finish(startedAt); err != nil {
 			return err
 		}
 	}
+
+	if cfg.Watermark != nil {
+		// The issues of failed pages would be skipped by the next export.
+		// Partial exports have already failed.
+		if failed := e.stats.failedPages.Load(); failed > 0 {
+			return fmt.Errorf("%d pages could not be fetched, leaving the watermark for the next export to fetch them again", failed)
+		}
+		if err := cfg.Watermark.Save(startedAt); err != nil {
+			return fmt.Errorf("failed to save the watermark: %w", err)
+		}
+	}
+
+	e.logger.Println("Jira issues export completed successfully.")
 	return nil
 }
 
-func worker(wg *sync.WaitGroup, jiraBaseURL, projectKey string, headers map[string]string, jobs <-chan int, results chan<- JiraResponse) {
-	defer wg.Done()
-	for startAt := range jobs {
-		jiraResp, err := fetchIssues(jiraBaseURL, projectKey, headers, startAt)
-		if err != nil {
-			log.Printf("Error fetching issues at startAt %d: %v", startAt, err)
-			continue
+// export fetches every page and hands the issues to the outputs, either page
+// by page when streaming or all at once after the last page has been fetched.
+// Fetching stops at deadline, when set, after which the issues fetched so far
+// are still written.
+func (e *exporter) export(ctx context.Context, deadline time.Time) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if e.cfg.Endpoint == EndpointServiceDesk {
+		e.logger.Printf("Exporting requests for service desk: %s", e.cfg.ServiceDeskID)
+	} else if len(e.cfg.IssueKeys) > 0 {
+		e.logger.Printf("Exporting %d issues by key", len(e.cfg.IssueKeys))
+	} else {
+		e.logger.Printf("Exporting issues for project key: %s", e.cfg.ProjectKey)
+	}
+
+	// The outputs are opened once the first page has been fetched.
+	var writers *writerGroup
+	var allIssues []JiraIssue
+	err := e.paginate(ctx, cancel, deadline, func(response JiraResponse) error {
+		if writers == nil {
+			if e.cfg.CSV != nil && e.cfg.CSV.FieldNames {
+				if err := e.resolveFieldNames(ctx); err != nil {
+					return err
+				}
+			}
+			var err error
+			if writers, err = e.openWriters(ctx); err != nil {
+				return err
+			}
 		}
-		results <- jiraResp
+		if e.cfg.Stream {
+			return e.write(ctx, writers, response.Issues)
+		}
+		allIssues = append(allIssues, response.Issues...)
+		return nil
+	})
+	if err == nil && !e.cfg.Stream {
+		e.checkFieldVisibility(allIssues, e.cfg.MissingFields)
+		err = e.write(ctx, writers, allIssues)
+	}
+	if err == nil && ctx.Err() != nil {
+		// Pages may have been lost to the cancellation.
+		err = ctx.Err()
 	}
+	if err != nil {
+		if writers != nil {
+			writers.abort()
+		}
+		return err
+	}
+	if err := writers.close(); err != nil {
+		return fmt.Errorf("failed to save issues: %w", err)
+	}
+	if e.bounds.truncated() {
+		return fmt.Errorf("partial export of %d issues, MaxDuration of %s exceeded: %w", e.stats.written.Load(), e.cfg.MaxDuration, context.DeadlineExceeded)
+	}
+	return nil
 }
 
-func ExportIssues(jiraBaseURL string, headers map[string]string, dbFile string, projectKey string, csvFile string, tableName string) {
-	log.Printf("Exporting issues for project key: %s", projectKey)
+// paginate fetches every page and hands each one to visit, the first page
+// first and the others as they arrive, one at a time. Fetching stops at
+// deadline, when set. After visit fails, cancel is called and the remaining
+// pages are drained, so that no worker stays blocked, before the error is
+// returned.
+func (e *exporter) paginate(ctx context.Context, cancel context.CancelFunc, deadline time.Time, visit func(JiraResponse) error) error {
+	fetchCtx := ctx
+	if !deadline.IsZero() {
+		var cancelFetch context.CancelFunc
+		fetchCtx, cancelFetch = context.WithDeadline(ctx, deadline)
+		defer cancelFetch()
+	}
+
 	var wg sync.WaitGroup
-	jobs := make(chan int, 10)             // Channel for startAt pagination values
-	results := make(chan JiraResponse, 10) // Channel for the results from API calls
+	// Bound the pages held when they are written one at a time, so that a
+	// slow output throttles the workers and the workers the generator.
+	buffer := 10
+	limit := e.cfg.MaxInFlight
+	if limit == 0 && (e.cfg.Stream || e.cfg.pagesOnly) {
+		limit = streamInFlight
+	}
+	if limit > 0 {
+		e.inFlight = make(chan struct{}, limit)
+		buffer = min(buffer, limit)
+	}
+	jobs := make(chan int, buffer)             // Channel for startAt pagination values
+	results := make(chan JiraResponse, buffer) // Channel for the results from API calls
 
-	// Start workers
-	numWorkers := 12
+	// Start workers, one every RampUp when set
 	for i := 0; i < numWorkers; i++ {
 		wg.Add(1)
-		go worker(&wg, jiraBaseURL, projectKey, headers, jobs, results)
+		go e.worker(fetchCtx, &wg, time.Duration(i)*e.cfg.RampUp, jobs, results)
+	}
+
+	if err := e.checkRequestedFields(fetchCtx); err != nil {
+		close(jobs)
+		return err
 	}
 
 	// Fetch first page to know total issues
-	firstResponse, err := fetchIssues(jiraBaseURL, projectKey, headers, 0)
+	firstResponse, err := e.fetchIssues(fetchCtx, 0)
 	if err != nil {
-		log.Fatalf("Failed to fetch first page: %v", err)
+		close(jobs)
+		return fmt.Errorf("failed to fetch first page: %w", err)
 	}
 
 	totalIssues := firstResponse.Total
-	log.Printf("Total number of issues: %d", totalIssues)
+	e.stats.total.Store(int64(totalIssues))
+	if totalIssues < 0 {
+		e.logger.Println("Total number of issues unknown, fetching until the last page.")
+	} else {
+		e.logger.Printf("Total number of issues: %d", totalIssues)
+	}
+	if guard := e.cfg.MaxTotalGuard; guard > 0 && totalIssues > guard {
+		close(jobs)
+		return fmt.Errorf("%d issues match %s, above the MaxTotalGuard of %d", totalIssues, e.cfg.query(), guard)
+	}
+
+	// Pages follow each other by the page size Jira actually applied,
+	// whatever was requested.
+	e.stride = pageSize
+	if limit := firstResponse.MaxResults; limit > 0 && limit < pageSize {
+		e.logger.Printf("Jira limits pages to %d issues instead of the %d requested, paginating by %d", limit, pageSize, limit)
+		e.stride = limit
+	} else if returned := len(firstResponse.Issues); limit == 0 && returned > 0 && returned < min(pageSize, totalIssues) {
+		// Without a reported page size, a short first page is the limit
+		// applied by Jira.
+		e.logger.Printf("Jira returned %d issues instead of the %d requested, paginating by %d", returned, pageSize, returned)
+		e.stride = returned
+	}
+	end := totalIssues
+	if bounded, ok := e.source.(boundedSource); ok {
+		end = bounded.pageCount() * pageSize
+	}
+
+	// Collect results, starting with the first page, visited before any
+	// other page is requested. After a failed visit the remaining pages are
+	// drained so that no worker stays blocked.
+	var visitErr error
+	collect := func(response JiraResponse) {
+		if visitErr != nil {
+			return
+		}
+		if visitErr = visit(response); visitErr != nil {
+			cancel()
+		}
+	}
+	collect(firstResponse)
+	done := firstResponse.last || visitErr != nil
 
-	// Send pagination jobs to the workers
+	// Send pagination jobs for the pages after the first to the workers.
+	// Without a total, pages are requested ahead until one of them is
+	// reported as the last. The generator stops as soon as the export is
+	// cancelled, so that it never stays blocked on a full channel.
 	go func() {
-		for startAt := 0; startAt < totalIssues; startAt += pageSize {
-			jobs <- startAt
+		defer close(jobs) // Close jobs channel after sending all jobs
+		if done {
+			return
+		}
+		for startAt := e.stride; end < 0 || startAt < end; startAt += e.stride {
+			if !e.acquire(fetchCtx) {
+				return
+			}
+			select {
+			case jobs <- startAt:
+			case <-e.lastPage:
+				e.release()
+				return
+			case <-fetchCtx.Done():
+				e.release()
+				return
+			}
 		}
-		close(jobs) // Close jobs channel after sending all jobs
 	}()
 
-	var allIssues []JiraIssue
-
-	// Collect results
 	go func() {
-		for response := range results {
-			allIssues = append(allIssues, response.Issues...)
-		}
+		wg.Wait()
+		close(results) // Close results channel when all workers are done
 	}()
 
-	wg.Wait()
-	close(results) // Close results channel when all workers are done
+	if !e.cfg.Ordered {
+		for response := range results {
+			if !response.failed {
+				collect(response)
+			}
+			e.release()
+		}
+		return visitErr
+	}
 
-	// Save to CSV and database
-	if err := saveIssuesToCSV(allIssues, csvFile); err != nil {
-		log.Fatalf("Failed to save issues to CSV: %v", err)
+	// Hand the pages over in the order of their offsets. A page waiting for
+	// an earlier one keeps its slot, so that MaxInFlight bounds the pages
+	// held.
+	merger := newPageMerger(e.stride, e.stride)
+	for response := range results {
+		for _, page := range merger.add(response) {
+			collect(page)
+			e.release()
+		}
+		if response.failed {
+			e.release()
+		}
+	}
+	for _, page := range merger.flush() {
+		collect(page)
+		e.release()
 	}
+	return visitErr
+}
 
-	if err := saveIssuesToDB(allIssues, dbFile, tableName); err != nil {
-		log.Fatalf("Failed to save issues to database: %v", err)
+// Paginate fetches the pages of issues selected by cfg as Export does, with
+// the same concurrency, retries and limits, and hands each page to visit with
+// its offset instead of writing the issues: the first page first, the others
+// as they are fetched, or by offset with Config.Ordered, one at a time. The
+// outputs of cfg, and the processing of issues they rely on, are ignored, and
+// Config.Watermark is loaded but never saved. Paginate stops at the first
+// error returned by visit, and returns it.
+func Paginate(ctx context.Context, cfg Config, visit func(page JiraResponse, startAt int) error) error {
+	startedAt := time.Now()
+	cfg = cfg.withoutOutputs()
+	e := newExporter(ctx, cfg)
+	if err := cfg.validate(e.logger); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	if err := e.prepareQuery(ctx, startedAt); err != nil {
+		return err
 	}
+	e.events = newEventQueue()
+	defer e.events.close()
 
-	log.Println("Jira issues export completed successfully.")
+	var deadline time.Time
+	if cfg.MaxDuration > 0 {
+		deadline = startedAt.Add(cfg.MaxDuration)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	err := e.paginate(ctx, cancel, deadline, func(page JiraResponse) error {
+		return visit(page, page.startAt)
+	})
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+	if e.bounds.truncated() {
+		return fmt.Errorf("pagination stopped before the last page, MaxDuration of %s exceeded: %w", cfg.MaxDuration, context.DeadlineExceeded)
+	}
+	return nil
 }
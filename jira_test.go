@@ -0,0 +1,443 @@
+package camembert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// fakeJira serves the search API over total issues, P-0 to P-<total-1>.
+type fakeJira struct {
+	total int
+	// limit, when set, lowers the page size as Jira clamps maxResults.
+	limit int
+	// hideLimit leaves maxResults out of the responses.
+	hideLimit bool
+	// fields are added, as they are, to the fields of every issue.
+	fields map[string]json.RawMessage
+	// edit, when set, changes the issue at index i before it is served.
+	edit func(i int, issue map[string]interface{})
+	// timeZone is the time zone of the user served by the myself endpoint.
+	timeZone string
+
+	mu       sync.Mutex
+	startAts []int
+}
+
+// fakeIssue returns the issue at index i of the fake Jira.
+func fakeIssue(i int) map[string]interface{} {
+	return map[string]interface{}{
+		"id":  strconv.Itoa(10000 + i),
+		"key": fmt.Sprintf("P-%d", i),
+		"fields": map[string]interface{}{
+			"summary": fmt.Sprintf("issue %d", i),
+			"status":  map[string]interface{}{"name": "Open"},
+		},
+	}
+}
+
+func (f *fakeJira) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/myself") {
+		json.NewEncoder(w).Encode(map[string]interface{}{"accountId": "me", "timeZone": f.timeZone})
+		return
+	}
+	startAt, _ := strconv.Atoi(r.URL.Query().Get("startAt"))
+	maxResults, _ := strconv.Atoi(r.URL.Query().Get("maxResults"))
+	if f.limit > 0 {
+		maxResults = min(maxResults, f.limit)
+	}
+	f.mu.Lock()
+	f.startAts = append(f.startAts, startAt)
+	f.mu.Unlock()
+
+	issues := []map[string]interface{}{}
+	for i := startAt; i < startAt+maxResults && i < f.total; i++ {
+		issue := fakeIssue(i)
+		for name, value := range f.fields {
+			issue["fields"].(map[string]interface{})[name] = value
+		}
+		if f.edit != nil {
+			f.edit(i, issue)
+		}
+		issues = append(issues, issue)
+	}
+	resp := map[string]interface{}{"issues": issues, "total": f.total, "startAt": startAt}
+	if !f.hideLimit {
+		resp["maxResults"] = maxResults
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// start serves f until the end of the test and returns a configuration
+// exporting its issues.
+func (f *fakeJira) start(t *testing.T) Config {
+	t.Helper()
+	return serve(t, f)
+}
+
+// serve serves handler, standing for Jira, until the end of the test and
+// returns a configuration exporting the issues of project P from it.
+func serve(t *testing.T, handler http.Handler) Config {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return Config{
+		JiraBaseURL: srv.URL + "/rest/api/2/search",
+		ProjectKey:  "P",
+		Headers:     map[string]string{"Authorization": "Bearer test"},
+	}
+}
+
+// requested returns the distinct startAt of the pages requested from f, in
+// increasing order.
+func (f *fakeJira) requested() []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var startAts []int
+	seen := make(map[int]bool)
+	for _, startAt := range f.startAts {
+		if !seen[startAt] {
+			seen[startAt] = true
+			startAts = append(startAts, startAt)
+		}
+	}
+	sort.Ints(startAts)
+	return startAts
+}
+
+// keyWriter keeps the keys of the issues it is handed.
+type keyWriter struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (w *keyWriter) WriteIssues(ctx context.Context, issues []JiraIssue) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, issue := range issues {
+		w.keys = append(w.keys, issue.Key)
+	}
+	return nil
+}
+
+func (w *keyWriter) Close() error { return nil }
+func (w *keyWriter) Abort() error { return nil }
+
+func TestExportClampedPageSize(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(io.Discard)
+
+	jira := &fakeJira{total: 350, limit: 100}
+	cfg := jira.start(t)
+	writer := &keyWriter{}
+	cfg.Writers = []Writer{writer}
+	result, err := Export(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(writer.keys) != 350 || result.Written != 350 {
+		t.Errorf("wrote %d issues, result %+v, want the 350 issues", len(writer.keys), result)
+	}
+	if got, want := jira.requested(), []int{0, 100, 200, 300}; !reflect.DeepEqual(got, want) {
+		t.Errorf("requested pages at %v, want %v", got, want)
+	}
+	if got := strings.Count(logs.String(), "Jira limits pages to 100 issues instead of the 1000 requested"); got != 1 {
+		t.Errorf("the page size limit was logged %d times, want once:\n%s", got, logs.String())
+	}
+}
+
+func TestExportMaxTotalGuard(t *testing.T) {
+	jira := &fakeJira{total: 2500}
+	cfg := jira.start(t)
+	cfg.MaxTotalGuard = 2000
+	writer := &keyWriter{}
+	cfg.Writers = []Writer{writer}
+	_, err := Export(context.Background(), cfg)
+	if err == nil || !strings.Contains(err.Error(), "2500 issues match") {
+		t.Fatalf("Export() error = %v, want the total above the guard", err)
+	}
+	if len(writer.keys) != 0 {
+		t.Errorf("wrote %d issues, want none", len(writer.keys))
+	}
+	if got, want := jira.requested(), []int{0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("requested pages at %v, want only the first page %v", got, want)
+	}
+}
+
+func TestExportPagination(t *testing.T) {
+	tests := []struct {
+		name  string
+		jira  *fakeJira
+		pages []int
+	}{
+		{name: "no issues", jira: &fakeJira{total: 0}, pages: []int{0}},
+		{name: "one issue", jira: &fakeJira{total: 1}, pages: []int{0}},
+		{name: "one full page", jira: &fakeJira{total: pageSize}, pages: []int{0}},
+		{name: "one more than a page", jira: &fakeJira{total: pageSize + 1}, pages: []int{0, pageSize}},
+		{name: "two full pages", jira: &fakeJira{total: 2 * pageSize}, pages: []int{0, pageSize}},
+		{name: "one more than two pages", jira: &fakeJira{total: 2*pageSize + 1}, pages: []int{0, pageSize, 2 * pageSize}},
+		{name: "smaller pages", jira: &fakeJira{total: 450, limit: 200}, pages: []int{0, 200, 400}},
+		{name: "smaller pages, exact", jira: &fakeJira{total: 400, limit: 200}, pages: []int{0, 200}},
+		{name: "smaller pages, unreported", jira: &fakeJira{total: 450, limit: 200, hideLimit: true}, pages: []int{0, 200, 400}},
+		{name: "one issue, unreported", jira: &fakeJira{total: 1, limit: 200, hideLimit: true}, pages: []int{0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jira := tt.jira
+			cfg := jira.start(t)
+			writer := &keyWriter{}
+			cfg.Writers = []Writer{writer}
+			result, err := Export(context.Background(), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			seen := make(map[string]bool)
+			for _, key := range writer.keys {
+				seen[key] = true
+			}
+			if len(writer.keys) != jira.total || len(seen) != jira.total {
+				t.Errorf("wrote %d issues, %d distinct, want %d", len(writer.keys), len(seen), jira.total)
+			}
+			if result.Total != jira.total || result.Written != jira.total || result.FailedPages != 0 {
+				t.Errorf("result = %+v, want %d issues written", result, jira.total)
+			}
+			if got := jira.requested(); !reflect.DeepEqual(got, tt.pages) {
+				t.Errorf("requested pages at %v, want %v", got, tt.pages)
+			}
+		})
+	}
+}
+
+// faultyJira delays or fails the pages of a Jira by offset. A delayed page
+// is not served once its request is cancelled.
+type faultyJira struct {
+	http.Handler
+	delays map[int]time.Duration
+	fails  map[int]bool
+}
+
+func (j *faultyJira) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	startAt, _ := strconv.Atoi(r.URL.Query().Get("startAt"))
+	if j.fails[startAt] {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	select {
+	case <-time.After(j.delays[startAt]):
+	case <-r.Context().Done():
+		return
+	}
+	j.Handler.ServeHTTP(w, r)
+}
+
+func TestExportOrdered(t *testing.T) {
+	// 10 pages of 50 issues, the second one arriving after the others.
+	delays := map[int]time.Duration{50: 100 * time.Millisecond}
+	tests := []struct {
+		name        string
+		fails       map[int]bool
+		maxInFlight int
+		// wantPeak bounds the pages fetched but not yet written.
+		wantPeak int64
+	}{
+		{name: "out of order", wantPeak: streamInFlight},
+		{name: "failed page", fails: map[int]bool{100: true}, wantPeak: streamInFlight},
+		{name: "MaxInFlight", maxInFlight: 3, wantPeak: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jira := &countingJira{fakeJira: &fakeJira{total: 500, limit: 50}}
+			cfg := serve(t, &faultyJira{Handler: jira, delays: delays, fails: tt.fails})
+			cfg.Stream = true
+			cfg.Ordered = true
+			cfg.MaxInFlight = tt.maxInFlight
+			keys := &keyWriter{}
+			held := &slowWriter{jira: jira}
+			cfg.Writers = []Writer{keys, held}
+			if _, err := Export(context.Background(), cfg); err != nil {
+				t.Fatal(err)
+			}
+
+			var want []string
+			for i := 0; i < 500; i++ {
+				if !tt.fails[i/50*50] {
+					want = append(want, fmt.Sprintf("P-%d", i))
+				}
+			}
+			if !reflect.DeepEqual(keys.keys, want) {
+				t.Errorf("wrote %d issues, want the %d issues of the pages fetched in order", len(keys.keys), len(want))
+			}
+			// The pages after the delayed one are held until it arrives.
+			if held.peak > tt.wantPeak || held.peak < 2 {
+				t.Errorf("up to %d pages were held, want between 2 and %d", held.peak, tt.wantPeak)
+			}
+		})
+	}
+}
+
+func TestExportMaxDuration(t *testing.T) {
+	// 50 pages of 10 issues, the second half hanging past the MaxDuration.
+	delays := make(map[int]time.Duration)
+	for startAt := 250; startAt < 500; startAt += 10 {
+		delays[startAt] = 5 * time.Second
+	}
+	jira := &fakeJira{total: 500, limit: 10}
+	cfg := serve(t, &faultyJira{Handler: jira, delays: delays})
+	file := filepath.Join(t.TempDir(), "issues.csv")
+	cfg.CSV = &CSVOutput{File: file, Fields: []FieldMapping{{Field: "summary"}}}
+	cfg.MaxDuration = 500 * time.Millisecond
+	start := time.Now()
+	result, err := Export(context.Background(), cfg)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Export() error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Export() took %s, want pages in flight given up at the MaxDuration", elapsed)
+	}
+	if result.Written < 250 || result.Written >= 500 {
+		t.Errorf("result = %+v, want the issues fetched before the MaxDuration written", result)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows := strings.Count(string(data), "\n") - 1; rows != result.Written {
+		t.Errorf("CSV has %d rows, want the %d issues written", rows, result.Written)
+	}
+}
+
+// rampJira serves the pages of a Jira after delay, recording how many were
+// in flight when each page past the first arrived, and when.
+type rampJira struct {
+	http.Handler
+	delay time.Duration
+
+	mu       sync.Mutex
+	inFlight int
+	arrivals []time.Time
+	counts   []int
+}
+
+func (j *rampJira) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("startAt") == "0" {
+		j.Handler.ServeHTTP(w, r)
+		return
+	}
+	j.mu.Lock()
+	j.inFlight++
+	j.arrivals = append(j.arrivals, time.Now())
+	j.counts = append(j.counts, j.inFlight)
+	j.mu.Unlock()
+	time.Sleep(j.delay)
+	j.Handler.ServeHTTP(w, r)
+	j.mu.Lock()
+	j.inFlight--
+	j.mu.Unlock()
+}
+
+func TestExportRampUp(t *testing.T) {
+	const rampUp = 50 * time.Millisecond
+	jira := &rampJira{Handler: &fakeJira{total: 600, limit: 10}, delay: 10 * time.Millisecond}
+	cfg := serve(t, jira)
+	cfg.RampUp = rampUp
+	writer := &keyWriter{}
+	cfg.Writers = []Writer{writer}
+	if _, err := Export(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if len(writer.keys) != 600 {
+		t.Fatalf("wrote %d issues, want 600", len(writer.keys))
+	}
+
+	// The workers started so far bound the pages in flight, allowing for one
+	// worker starting late.
+	jira.mu.Lock()
+	defer jira.mu.Unlock()
+	first := jira.arrivals[0]
+	peak := 0
+	for i, arrival := range jira.arrivals {
+		started := int(arrival.Sub(first)/rampUp) + 1
+		if jira.counts[i] > started+1 {
+			t.Errorf("%d pages in flight %s after the first one, want at most %d workers started", jira.counts[i], arrival.Sub(first), started)
+		}
+		peak = max(peak, jira.counts[i])
+	}
+	if peak < 3 {
+		t.Errorf("up to %d pages were in flight, want the workers started over time", peak)
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	for _, ordered := range []bool{false, true} {
+		jira := &fakeJira{total: 350, limit: 100}
+		cfg := jira.start(t)
+		cfg.Ordered = ordered
+		// Outputs are ignored.
+		file := filepath.Join(t.TempDir(), "issues.csv")
+		cfg.CSV = &CSVOutput{File: file}
+		var startAts []int
+		issues := make(map[int]int)
+		err := Paginate(context.Background(), cfg, func(page JiraResponse, startAt int) error {
+			startAts = append(startAts, startAt)
+			issues[startAt] = len(page.Issues)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(startAts) != 4 || startAts[0] != 0 {
+			t.Errorf("Ordered %t: visited pages at %v, want the 4 pages, the first one first", ordered, startAts)
+		}
+		if ordered && !sort.IntsAreSorted(startAts) {
+			t.Errorf("Ordered: visited pages at %v, want them by offset", startAts)
+		}
+		if want := map[int]int{0: 100, 100: 100, 200: 100, 300: 50}; !reflect.DeepEqual(issues, want) {
+			t.Errorf("Ordered %t: issues per page = %v, want %v", ordered, issues, want)
+		}
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Errorf("Ordered %t: the CSV output was written: %v", ordered, err)
+		}
+	}
+}
+
+func TestPaginateVisitError(t *testing.T) {
+	cfg := (&fakeJira{total: 350, limit: 10}).start(t)
+	errStop := errors.New("stop")
+	visited := 0
+	err := Paginate(context.Background(), cfg, func(page JiraResponse, startAt int) error {
+		visited++
+		if visited == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if !errors.Is(err, errStop) {
+		t.Fatalf("Paginate() error = %v, want the visit error", err)
+	}
+	if visited != 2 {
+		t.Errorf("visited %d pages, want the visits to stop at the error", visited)
+	}
+}
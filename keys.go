@@ -0,0 +1,88 @@
+package camembert
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	// maxKeysPerQuery caps the keys of a single key IN query, so that each
+	// query fits in one page even where Jira lowers maxResults to 100.
+	maxKeysPerQuery = 100
+	// maxKeysJQLLength caps the length of a key IN query, keeping request
+	// URLs well below the limits of Jira and the proxies in front of it.
+	maxKeysJQLLength = 4000
+)
+
+// keyChunks splits keys into the lists of the key IN queries used to fetch
+// them, dropping empty and duplicate keys.
+func keyChunks(keys []string) [][]string {
+	var chunks [][]string
+	var chunk []string
+	length := 0
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		quoted := len(jqlString(key)) + 1 // separator
+		if len(chunk) == maxKeysPerQuery || (len(chunk) > 0 && length+quoted > maxKeysJQLLength) {
+			chunks = append(chunks, chunk)
+			chunk, length = nil, 0
+		}
+		chunk = append(chunk, key)
+		length += quoted
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// keysJQL returns the JQL query matching the issues with the given keys.
+func keysJQL(keys []string) string {
+	quoted := make([]string, len(keys))
+	for i, key := range keys {
+		quoted[i] = jqlString(key)
+	}
+	return fmt.Sprintf("key IN (%s)", strings.Join(quoted, ","))
+}
+
+// jqlEscaper escapes the characters JQL escapes in quoted strings.
+var jqlEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// jqlString quotes s as a JQL string, escaping only double quotes and
+// backslashes.
+func jqlString(s string) string {
+	return `"` + jqlEscaper.Replace(s) + `"`
+}
+
+// keysSource fetches a fixed list of issues with one key IN query per chunk
+// of keys. The page at startAt holds the chunk at startAt / pageSize, and the
+// total is not reported since keys unknown to Jira are not returned.
+type keysSource struct {
+	chunks [][]string
+}
+
+func (s keysSource) pageCount() int {
+	return len(s.chunks)
+}
+
+func (s keysSource) fetchPage(ctx context.Context, e *exporter, startAt int) (JiraResponse, error) {
+	chunk := startAt / pageSize
+	if chunk >= len(s.chunks) {
+		return JiraResponse{Total: -1, last: true}, nil
+	}
+	resp, err := searchPage(ctx, e, keysJQL(s.chunks[chunk]), 0, e.fields, e.cfg.Expand)
+	if err != nil {
+		return JiraResponse{}, err
+	}
+	// Offsets identify chunks, whatever the page size applied by Jira
+	resp.Total = -1
+	resp.MaxResults = 0
+	resp.last = chunk == len(s.chunks)-1
+	return resp, nil
+}
@@ -0,0 +1,129 @@
+package camembert
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Manifest describes a completed export run.
+type Manifest struct {
+	RequestID  string         `json:"requestId,omitempty"`
+	ProjectKey string         `json:"projectKey,omitempty"`
+	StartedAt  time.Time      `json:"startedAt"`
+	FinishedAt time.Time      `json:"finishedAt"`
+	Issues     int            `json:"issues"`
+	Files      []ManifestFile `json:"files"`
+	// Fields lists the fields found on the exported issues when
+	// Config.FieldSnapshot is set.
+	Fields []ManifestField `json:"fields,omitempty"`
+}
+
+// ManifestFile is an output file of an export run. SHA256 is only set when
+// checksums are enabled.
+type ManifestFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// outputFiles returns every file written by the export, each once.
+func (c Config) outputFiles() []string {
+	var files []string
+	seen := make(map[string]bool)
+	add := func(path string) {
+		if path != "" && !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+	if c.CSV != nil {
+		add(c.CSV.File)
+	}
+	if c.DB != nil {
+		add(c.DB.File)
+	}
+	if c.Users != nil {
+		add(c.Users.CSVFile)
+	}
+	if c.Sprints != nil {
+		add(c.Sprints.CSVFile)
+	}
+	if c.Visibility != nil {
+		add(c.Visibility.CSVFile)
+	}
+	if c.FieldDefinitions != nil {
+		add(c.FieldDefinitions.CSVFile)
+	}
+	add(c.ProfileFile)
+	if c.Diagnostics != nil {
+		add(c.Diagnostics.CSVFile)
+	}
+	return files
+}
+
+// fileChecksum returns the hex encoded SHA-256 digest of the file at path.
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// writeChecksum writes a .sha256 sidecar next to path in the format read by
+// sha256sum -c, and returns the digest.
+func writeChecksum(path string) (string, error) {
+	sum, err := fileChecksum(path)
+	if err != nil {
+		return "", err
+	}
+	line := fmt.Sprintf("%s  %s\n", sum, filepath.Base(path))
+	if err := os.WriteFile(path+".sha256", []byte(line), 0o666); err != nil {
+		return "", err
+	}
+	return sum, nil
+}
+
+// finish writes the checksums and the manifest of a successful export.
+func (e *exporter) finish(startedAt time.Time) error {
+	manifest := Manifest{
+		RequestID:  e.requestID,
+		ProjectKey: e.cfg.ProjectKey,
+		StartedAt:  startedAt,
+		Issues:     int(e.stats.written.Load()),
+		Fields:     e.snapshot,
+	}
+	for _, path := range e.cfg.outputFiles() {
+		file := ManifestFile{Path: path}
+		if e.cfg.Checksums {
+			sum, err := writeChecksum(path)
+			if err != nil {
+				return fmt.Errorf("failed to write checksum of %s: %w", path, err)
+			}
+			file.SHA256 = sum
+		}
+		manifest.Files = append(manifest.Files, file)
+	}
+
+	if e.cfg.ManifestFile == "" {
+		return nil
+	}
+	e.logger.Printf("Saving manifest to %s", e.cfg.ManifestFile)
+	manifest.FinishedAt = time.Now()
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(e.cfg.ManifestFile, append(manifestJSON, '\n'), 0o666)
+}
@@ -0,0 +1,82 @@
+package camembert
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExportChecksumsAndManifest(t *testing.T) {
+	dir := t.TempDir()
+	cfg := (&fakeJira{total: 3}).start(t)
+	cfg.CSV = &CSVOutput{File: filepath.Join(dir, "issues.csv"), Fields: []FieldMapping{{Field: "summary"}}}
+	cfg.Checksums = true
+	cfg.ManifestFile = filepath.Join(dir, "manifest.json")
+	if _, err := Export(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(cfg.CSV.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(data)
+	sum := hex.EncodeToString(digest[:])
+	sidecar, err := os.ReadFile(cfg.CSV.File + ".sha256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(sidecar), sum+"  issues.csv\n"; got != want {
+		t.Errorf("checksum sidecar = %q, want %q", got, want)
+	}
+
+	manifestJSON, err := os.ReadFile(cfg.ManifestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(manifestJSON, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Issues != 3 || manifest.ProjectKey != "P" {
+		t.Errorf("manifest = %+v, want the 3 issues of project P", manifest)
+	}
+	if manifest.StartedAt.IsZero() || manifest.FinishedAt.Before(manifest.StartedAt) {
+		t.Errorf("manifest ran from %s to %s, want a start before the finish", manifest.StartedAt, manifest.FinishedAt)
+	}
+	if len(manifest.Files) != 1 || manifest.Files[0] != (ManifestFile{Path: cfg.CSV.File, SHA256: sum}) {
+		t.Errorf("manifest files = %+v, want the CSV file with its checksum %s", manifest.Files, sum)
+	}
+	if _, err := os.Stat(cfg.ManifestFile + ".sha256"); !os.IsNotExist(err) {
+		t.Errorf("the manifest has a checksum sidecar, want none: %v", err)
+	}
+}
+
+func TestExportManifestWithoutChecksums(t *testing.T) {
+	dir := t.TempDir()
+	cfg := (&fakeJira{total: 2}).start(t)
+	cfg.CSV = &CSVOutput{File: filepath.Join(dir, "issues.csv"), Fields: []FieldMapping{{Field: "summary"}}}
+	cfg.ManifestFile = filepath.Join(dir, "manifest.json")
+	if _, err := Export(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	manifestJSON, err := os.ReadFile(cfg.ManifestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(manifestJSON, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Files) != 1 || manifest.Files[0] != (ManifestFile{Path: cfg.CSV.File}) {
+		t.Errorf("manifest files = %+v, want the CSV file without a checksum", manifest.Files)
+	}
+	if _, err := os.Stat(cfg.CSV.File + ".sha256"); !os.IsNotExist(err) {
+		t.Errorf("checksum sidecar written without Checksums: %v", err)
+	}
+}
@@ -0,0 +1,341 @@
+package camembert
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MarkdownOutput writes the description and comments of every issue to a
+// Markdown file named after its key, such as PROJ-123.md, for a browsable
+// archive next to the tabular outputs. Descriptions and comments are
+// converted from the Atlassian Document Format or the wiki markup of Jira
+// Server as far as Markdown allows. Like other output files, the export fails
+// when Dir already holds Markdown files unless Config.OnExisting allows
+// replacing them.
+type MarkdownOutput struct {
+	Dir string
+	// SkipEmpty writes no file for issues having neither a description nor
+	// comments, instead of a file holding the title only.
+	SkipEmpty bool
+}
+
+// markdownFields are the fields read by the Markdown output.
+var markdownFields = []string{"summary", "description", "comment"}
+
+// markdownWriter writes a Markdown file per issue.
+type markdownWriter struct {
+	output MarkdownOutput
+}
+
+func (e *exporter) newMarkdownWriter(output MarkdownOutput) (*markdownWriter, error) {
+	e.logger.Printf("Saving issues as Markdown to directory: %s", output.Dir)
+	if err := os.MkdirAll(output.Dir, 0o777); err != nil {
+		return nil, err
+	}
+	return &markdownWriter{output: output}, nil
+}
+
+func (w *markdownWriter) WriteIssues(ctx context.Context, issues []JiraIssue) error {
+	for _, issue := range issues {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if issue.Key == "" {
+			continue
+		}
+		document, empty := issueMarkdown(issue)
+		if empty && w.output.SkipEmpty {
+			continue
+		}
+		path := filepath.Join(w.output.Dir, filepath.Base(issue.Key)+".md")
+		if err := os.WriteFile(path, []byte(document), 0o666); err != nil {
+			return fmt.Errorf("failed to write Markdown file: %w", err)
+		}
+	}
+	return nil
+}
+
+func (w *markdownWriter) Close() error { return nil }
+
+// Abort keeps the files written so far.
+func (w *markdownWriter) Abort() error { return nil }
+
+// issueMarkdown renders the description and comments of issue, and reports
+// whether it has neither.
+func issueMarkdown(issue JiraIssue) (string, bool) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s", issue.Key)
+	if summary := fieldValue(issue.Fields, "summary"); summary != "" {
+		fmt.Fprintf(&b, ": %s", summary)
+	}
+	b.WriteString("\n")
+
+	description := markdown(issue.Fields["description"])
+	if description != "" {
+		fmt.Fprintf(&b, "\n## Description\n\n%s\n", description)
+	}
+
+	comments, _ := fieldAt(issue.Fields, "comment.comments").([]interface{})
+	if len(comments) > 0 {
+		b.WriteString("\n## Comments\n")
+	}
+	for _, comment := range comments {
+		comment, ok := comment.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&b, "\n### %s, %s\n\n%s\n", fieldValue(comment, "author.displayName"), fieldValue(comment, "created"), markdown(comment["body"]))
+	}
+	return b.String(), description == "" && len(comments) == 0
+}
+
+// markdown converts a description or comment body to Markdown, whether it
+// is wiki markup or an Atlassian Document Format document.
+func markdown(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(wikiMarkdown(v))
+	case map[string]interface{}:
+		return strings.TrimSpace(adfBlock(v))
+	default:
+		return ""
+	}
+}
+
+// adfChildren returns the child nodes of an ADF node.
+func adfChildren(node map[string]interface{}) []map[string]interface{} {
+	content, _ := node["content"].([]interface{})
+	children := make([]map[string]interface{}, 0, len(content))
+	for _, child := range content {
+		if child, ok := child.(map[string]interface{}); ok {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// adfAttr returns an attribute of an ADF node as a string.
+func adfAttr(node map[string]interface{}, name string) string {
+	return fieldValue(node, "attrs."+name)
+}
+
+// adfBlocks renders the children of node as blocks separated by blank lines,
+// or by line breaks within list items so that lists stay tight.
+func adfBlocks(node map[string]interface{}) string {
+	var blocks []string
+	for _, child := range adfChildren(node) {
+		if block := adfBlock(child); block != "" {
+			blocks = append(blocks, block)
+		}
+	}
+	if node["type"] == "listItem" {
+		return strings.Join(blocks, "\n")
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+// indent prefixes every line of s but the first with prefix.
+func indent(s string, prefix string) string {
+	return strings.ReplaceAll(s, "\n", "\n"+prefix)
+}
+
+// adfBlock renders a block node of the Atlassian Document Format.
+func adfBlock(node map[string]interface{}) string {
+	switch node["type"] {
+	case "paragraph":
+		return adfInline(node)
+	case "heading":
+		level, _ := strconv.Atoi(adfAttr(node, "level"))
+		return strings.Repeat("#", min(max(level, 1), 6)) + " " + adfInline(node)
+	case "bulletList", "orderedList":
+		var items []string
+		for i, item := range adfChildren(node) {
+			marker := "- "
+			if node["type"] == "orderedList" {
+				marker = strconv.Itoa(i+1) + ". "
+			}
+			items = append(items, marker+indent(adfBlocks(item), strings.Repeat(" ", len(marker))))
+		}
+		return strings.Join(items, "\n")
+	case "codeBlock":
+		return "```" + adfAttr(node, "language") + "\n" + adfText(node) + "```"
+	case "blockquote", "panel":
+		return "> " + indent(adfBlocks(node), "> ")
+	case "rule":
+		return "---"
+	case "table":
+		var rows []string
+		for i, row := range adfChildren(node) {
+			var cells []string
+			for _, cell := range adfChildren(row) {
+				cells = append(cells, strings.ReplaceAll(adfBlocks(cell), "\n", " "))
+			}
+			rows = append(rows, "| "+strings.Join(cells, " | ")+" |")
+			if i == 0 {
+				rows = append(rows, strings.Repeat("| --- ", len(cells))+"|")
+			}
+		}
+		return strings.Join(rows, "\n")
+	case "mediaSingle", "mediaGroup":
+		return "*[attachment]*"
+	default:
+		return adfBlocks(node)
+	}
+}
+
+// adfInline renders the inline content of node.
+func adfInline(node map[string]interface{}) string {
+	var b strings.Builder
+	for _, child := range adfChildren(node) {
+		switch child["type"] {
+		case "text":
+			b.WriteString(adfMarks(child))
+		case "hardBreak":
+			b.WriteString("  \n")
+		case "mention", "emoji", "status":
+			b.WriteString(adfAttr(child, "text"))
+		case "inlineCard":
+			b.WriteString("<" + adfAttr(child, "url") + ">")
+		default:
+			b.WriteString(adfInline(child))
+		}
+	}
+	return b.String()
+}
+
+// adfMarks renders a text node with its marks applied.
+func adfMarks(node map[string]interface{}) string {
+	text, _ := node["text"].(string)
+	marks, _ := node["marks"].([]interface{})
+	for _, mark := range marks {
+		mark, ok := mark.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch mark["type"] {
+		case "code":
+			text = "`" + text + "`"
+		case "strong":
+			text = "**" + text + "**"
+		case "em":
+			text = "*" + text + "*"
+		case "strike":
+			text = "~~" + text + "~~"
+		case "link":
+			text = "[" + text + "](" + adfAttr(mark, "href") + ")"
+		}
+	}
+	return text
+}
+
+var (
+	wikiHeading = regexp.MustCompile(`^h([1-6])\.\s+(.*)$`)
+	wikiList    = regexp.MustCompile(`^([*#-]+)\s+(.*)$`)
+	wikiCode    = regexp.MustCompile(`^\{(code|noformat)(?::([^}|]*))?[^}]*\}(.*)$`)
+	wikiBold    = regexp.MustCompile(`(^|[^\w*])\*([^*\s](?:[^*\n]*[^*\s])?)\*([^\w*]|$)`)
+	wikiItalic  = regexp.MustCompile(`(^|[^\w_])_([^_\s](?:[^_\n]*[^_\s])?)_([^\w_]|$)`)
+	wikiMono    = regexp.MustCompile(`\{\{(.+?)\}\}`)
+	wikiLink    = regexp.MustCompile(`\[([^|\]\n]+)\|([^\]\n]+)\]`)
+	wikiURL     = regexp.MustCompile(`\[((?:https?|mailto):[^\]\n]+)\]`)
+	wikiUser    = regexp.MustCompile(`\[~([^\]\n]+)\]`)
+)
+
+// wikiMarkdown converts the Jira wiki markup of Jira Server to Markdown.
+// Headings, lists, quotes, code blocks, tables, links and the common text
+// effects are converted, anything else is kept as-is.
+func wikiMarkdown(s string) string {
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	var out []string
+	fence := "" // macro closing the current code block
+	for _, line := range lines {
+		if fence != "" {
+			if before, _, found := strings.Cut(line, "{"+fence+"}"); found {
+				if before != "" {
+					out = append(out, before)
+				}
+				out = append(out, "```")
+				fence = ""
+				continue
+			}
+			out = append(out, line)
+			continue
+		}
+		if m := wikiCode.FindStringSubmatch(line); m != nil {
+			out = append(out, "```"+strings.TrimSpace(m[2]))
+			fence = m[1]
+			if rest, _, found := strings.Cut(m[3], "{"+fence+"}"); found {
+				out = append(out, rest, "```")
+				fence = ""
+			} else if m[3] != "" {
+				out = append(out, m[3])
+			}
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case wikiHeading.MatchString(trimmed):
+			m := wikiHeading.FindStringSubmatch(trimmed)
+			level, _ := strconv.Atoi(m[1])
+			out = append(out, strings.Repeat("#", level)+" "+wikiInline(m[2]))
+		case strings.HasPrefix(trimmed, "bq. "):
+			out = append(out, "> "+wikiInline(strings.TrimPrefix(trimmed, "bq. ")))
+		case trimmed == "----":
+			out = append(out, "---")
+		case strings.HasPrefix(trimmed, "||"):
+			cells := strings.Split(strings.Trim(trimmed, "|"), "||")
+			for i := range cells {
+				cells[i] = wikiInline(strings.TrimSpace(cells[i]))
+			}
+			out = append(out, "| "+strings.Join(cells, " | ")+" |", strings.Repeat("| --- ", len(cells))+"|")
+		case strings.HasPrefix(trimmed, "|"):
+			cells := strings.Split(strings.Trim(trimmed, "|"), "|")
+			for i := range cells {
+				cells[i] = wikiInline(strings.TrimSpace(cells[i]))
+			}
+			out = append(out, "| "+strings.Join(cells, " | ")+" |")
+		case wikiList.MatchString(trimmed) && trimmed != "----":
+			m := wikiList.FindStringSubmatch(trimmed)
+			marker := "- "
+			if strings.HasSuffix(m[1], "#") {
+				marker = "1. "
+			}
+			out = append(out, strings.Repeat("  ", len(m[1])-1)+marker+wikiInline(m[2]))
+		default:
+			out = append(out, wikiInline(line))
+		}
+	}
+	if fence != "" {
+		out = append(out, "```")
+	}
+	return strings.Join(out, "\n")
+}
+
+// wikiInline converts the text effects and links of a line of wiki markup.
+func wikiInline(s string) string {
+	s = wikiMono.ReplaceAllString(s, "`$1`")
+	s = wikiLink.ReplaceAllString(s, "[$1]($2)")
+	s = wikiURL.ReplaceAllString(s, "<$1>")
+	s = wikiUser.ReplaceAllString(s, "@$1")
+	s = replaceRepeatedly(wikiBold, s, "$1**$2**$3")
+	s = replaceRepeatedly(wikiItalic, s, "$1*$2*$3")
+	return s
+}
+
+// replaceRepeatedly replaces the matches of re in s until none is left. A
+// match of the text effects consumes the character after its closing
+// delimiter, which the next effect may need as its boundary, as in *a* *b*.
+func replaceRepeatedly(re *regexp.Regexp, s, repl string) string {
+	for {
+		replaced := re.ReplaceAllString(s, repl)
+		if replaced == s {
+			return s
+		}
+		s = replaced
+	}
+}
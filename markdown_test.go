@@ -0,0 +1,84 @@
+package camembert
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWikiInline(t *testing.T) {
+	tests := []struct {
+		name string
+		wiki string
+		want string
+	}{
+		{name: "bold", wiki: "a *bold* word", want: "a **bold** word"},
+		{name: "adjacent bold", wiki: "*a* *b* *c*", want: "**a** **b** **c**"},
+		{name: "adjacent italic", wiki: "_a_ _b_", want: "*a* *b*"},
+		{name: "bold then italic", wiki: "*a* _b_ *c*", want: "**a** *b* **c**"},
+		{name: "inside words", wiki: "snake_case_name and 2*3*4", want: "snake_case_name and 2*3*4"},
+		{name: "list marker", wiki: "* item", want: "* item"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := wikiInline(tt.wiki); got != tt.want {
+				t.Errorf("wikiInline(%q) = %q, want %q", tt.wiki, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkdownExistingFiles(t *testing.T) {
+	tests := []struct {
+		name       string
+		onExisting ExistingFilePolicy
+		wantErr    bool
+	}{
+		{name: "error", onExisting: ExistingError, wantErr: true},
+		{name: "overwrite", onExisting: ExistingOverwrite},
+		{name: "append", onExisting: ExistingAppend},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			existing := filepath.Join(dir, "P-0.md")
+			if err := os.WriteFile(existing, []byte("kept\n"), 0o666); err != nil {
+				t.Fatal(err)
+			}
+			cfg := (&fakeJira{total: 2}).start(t)
+			cfg.Markdown = &MarkdownOutput{Dir: dir}
+			cfg.OnExisting = tt.onExisting
+			_, err := Export(context.Background(), cfg)
+			data, _ := os.ReadFile(existing)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "already exists") {
+					t.Errorf("Export() error = %v, want the existing file reported", err)
+				}
+				if string(data) != "kept\n" {
+					t.Errorf("P-0.md = %q, want it untouched", data)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(data), "issue 0") {
+				t.Errorf("P-0.md = %q, want it replaced", data)
+			}
+		})
+	}
+}
+
+func TestMarkdownEmptyDirectory(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	cfg := (&fakeJira{total: 2}).start(t)
+	cfg.Markdown = &MarkdownOutput{Dir: dir}
+	if _, err := Export(context.Background(), cfg); err != nil {
+		t.Fatalf("Export() error = %v, want other files ignored", err)
+	}
+}
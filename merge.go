@@ -0,0 +1,55 @@
+package camembert
+
+import "sort"
+
+// pageMerger merges the pages fetched by the workers, each fetching its pages
+// in increasing offsets, into a single stream ordered by offset. Since the
+// pages of an ordered query follow each other, the stream is then ordered as
+// the query is. Only the pages arriving ahead of one still in flight are
+// held, at most Config.MaxInFlight of them when set.
+type pageMerger struct {
+	next    int
+	stride  int
+	pending map[int]JiraResponse
+}
+
+func newPageMerger(next, stride int) *pageMerger {
+	return &pageMerger{next: next, stride: stride, pending: make(map[int]JiraResponse)}
+}
+
+// add records page and returns the pages that can be handed over in order,
+// skipping the failed ones.
+func (m *pageMerger) add(page JiraResponse) []JiraResponse {
+	m.pending[page.startAt] = page
+	var ready []JiraResponse
+	for {
+		page, ok := m.pending[m.next]
+		if !ok {
+			return ready
+		}
+		delete(m.pending, m.next)
+		m.next += m.stride
+		if !page.failed {
+			ready = append(ready, page)
+		}
+	}
+}
+
+// flush returns the pages still held once every page has arrived, in order,
+// which only happens when the offset of a page was never reached because
+// fetching stopped early.
+func (m *pageMerger) flush() []JiraResponse {
+	offsets := make([]int, 0, len(m.pending))
+	for startAt := range m.pending {
+		offsets = append(offsets, startAt)
+	}
+	sort.Ints(offsets)
+	var ready []JiraResponse
+	for _, startAt := range offsets {
+		if page := m.pending[startAt]; !page.failed {
+			ready = append(ready, page)
+		}
+	}
+	m.pending = nil
+	return ready
+}
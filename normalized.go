@@ -0,0 +1,142 @@
+package camembert
+
+import (
+	"fmt"
+)
+
+// ChildTables configures normalized tables in the database of the DB output
+// for the fields holding several values per issue, so that they can be
+// queried relationally, for example to find every issue with a label.
+//
+// The rows of every exported issue replace the ones it had, so that labels
+// and components removed since a previous run are removed from an appended
+// database as well. Issues without labels or components have no rows. The
+// rows are written after the issues, in one transaction, and collected in
+// memory until then, including when Config.Stream is set.
+type ChildTables struct {
+	// Labels, when set, names the table receiving one row per issue and
+	// label, with issue_id and label columns, such as issue_labels.
+	Labels string
+	// Components, when set, names the table receiving one row per issue and
+	// component, with issue_id, component_id and component_name columns,
+	// such as issue_components.
+	Components string
+}
+
+// childFields are the fields the child tables are read from.
+var childFields = []string{"labels", "components"}
+
+// issueComponent is a component of an issue.
+type issueComponent struct {
+	id   string
+	name string
+}
+
+// issueChildren holds the labels and components of an issue. A nil slice
+// marks a field missing from the issue, whose rows are left as they are.
+type issueChildren struct {
+	issueID    string
+	labels     []string
+	components []issueComponent
+}
+
+func (e *exporter) addChildren(issues []JiraIssue) {
+	for _, issue := range issues {
+		children := issueChildren{issueID: issue.ID}
+		if value, ok := issue.Fields["labels"]; ok {
+			children.labels = []string{}
+			items, _ := value.([]interface{})
+			for _, item := range items {
+				if label, ok := item.(string); ok {
+					children.labels = append(children.labels, label)
+				}
+			}
+		}
+		if value, ok := issue.Fields["components"]; ok {
+			children.components = []issueComponent{}
+			items, _ := value.([]interface{})
+			for _, item := range items {
+				if component, ok := item.(map[string]interface{}); ok {
+					children.components = append(children.components, issueComponent{id: fieldValue(component, "id"), name: fieldValue(component, "name")})
+				}
+			}
+		}
+		e.children = append(e.children, children)
+	}
+}
+
+func (e *exporter) saveChildTables(tables ChildTables, dbFile string) error {
+	db, err := e.openDB(dbFile)
+	if err != nil {
+		return err
+	}
+	defer e.releaseDB(db)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin a transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if tables.Labels != "" {
+		e.logger.Printf("Saving labels to DB file %s in table %s.", dbFile, tables.Labels)
+		createTableSQL := fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s (
+		issue_id TEXT,
+		label TEXT,
+		PRIMARY KEY (issue_id, label)
+	);`, tables.Labels)
+		if _, err := tx.Exec(createTableSQL); err != nil {
+			return fmt.Errorf("failed to create the table in the database: %w", err)
+		}
+		deleteSQL := fmt.Sprintf(`DELETE FROM %s WHERE issue_id = ?`, tables.Labels)
+		insertSQL := fmt.Sprintf(`INSERT OR REPLACE INTO %s (issue_id, label) VALUES (?, ?)`, tables.Labels)
+		for _, c := range e.children {
+			if c.labels == nil {
+				continue
+			}
+			if _, err := tx.Exec(deleteSQL, c.issueID); err != nil {
+				return fmt.Errorf("could not delete values from the table: %w", err)
+			}
+			for _, label := range c.labels {
+				if _, err := tx.Exec(insertSQL, c.issueID, label); err != nil {
+					return fmt.Errorf("could not insert values in the table: %w", err)
+				}
+			}
+		}
+	}
+
+	if tables.Components != "" {
+		e.logger.Printf("Saving components to DB file %s in table %s.", dbFile, tables.Components)
+		createTableSQL := fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s (
+		issue_id TEXT,
+		component_id TEXT,
+		component_name TEXT,
+		PRIMARY KEY (issue_id, component_id)
+	);`, tables.Components)
+		if _, err := tx.Exec(createTableSQL); err != nil {
+			return fmt.Errorf("failed to create the table in the database: %w", err)
+		}
+		deleteSQL := fmt.Sprintf(`DELETE FROM %s WHERE issue_id = ?`, tables.Components)
+		insertSQL := fmt.Sprintf(`INSERT OR REPLACE INTO %s (issue_id, component_id, component_name) VALUES (?, ?, ?)`, tables.Components)
+		for _, c := range e.children {
+			if c.components == nil {
+				continue
+			}
+			if _, err := tx.Exec(deleteSQL, c.issueID); err != nil {
+				return fmt.Errorf("could not delete values from the table: %w", err)
+			}
+			for _, component := range c.components {
+				if _, err := tx.Exec(insertSQL, c.issueID, component.id, component.name); err != nil {
+					return fmt.Errorf("could not insert values in the table: %w", err)
+				}
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit the transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package camembert
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// queryRows returns the rows of query, each one joined with "|".
+func queryRows(t *testing.T, db *sql.DB, query string) []string {
+	t.Helper()
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for rows.Next() {
+		values := make([]string, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			t.Fatal(err)
+		}
+		row := values[0]
+		for _, value := range values[1:] {
+			row += "|" + value
+		}
+		got = append(got, row)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestChildTables(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "issues.db")
+	export := func(edit func(i int, fields map[string]interface{})) {
+		t.Helper()
+		cfg := (&fakeJira{total: 3, edit: func(i int, issue map[string]interface{}) {
+			edit(i, issue["fields"].(map[string]interface{}))
+		}}).start(t)
+		cfg.DB = &DBOutput{File: file, Table: "issues", Append: true}
+		cfg.ChildTables = &ChildTables{Labels: "issue_labels", Components: "issue_components"}
+		if _, err := Export(context.Background(), cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// P-0 has two labels and a component, P-1 a label, P-2 neither.
+	export(func(i int, fields map[string]interface{}) {
+		switch i {
+		case 0:
+			fields["labels"] = []string{"backend", "urgent"}
+			fields["components"] = []map[string]interface{}{{"id": "1", "name": "API"}}
+		case 1:
+			fields["labels"] = []string{"frontend"}
+			fields["components"] = []map[string]interface{}{}
+		case 2:
+			fields["labels"] = []string{}
+		}
+	})
+	db, err := sql.Open("sqlite3", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	labels := "SELECT issue_id, label FROM issue_labels ORDER BY issue_id, label"
+	components := "SELECT issue_id, component_id, component_name FROM issue_components ORDER BY issue_id, component_id"
+	if got, want := queryRows(t, db, labels), []string{"10000|backend", "10000|urgent", "10001|frontend"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("labels = %v, want %v", got, want)
+	}
+	if got, want := queryRows(t, db, components), []string{"10000|1|API"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("components = %v, want %v", got, want)
+	}
+
+	// An appended export replaces the rows of the issues it exports, keeping
+	// the rows of fields missing from an issue.
+	export(func(i int, fields map[string]interface{}) {
+		switch i {
+		case 0:
+			fields["labels"] = []string{"urgent"}
+		case 1:
+			fields["labels"] = []string{}
+			fields["components"] = []map[string]interface{}{{"id": "2", "name": "UI"}}
+		}
+	})
+	if got, want := queryRows(t, db, labels), []string{"10000|urgent"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("labels after appending = %v, want %v", got, want)
+	}
+	if got, want := queryRows(t, db, components), []string{"10000|1|API", "10001|2|UI"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("components after appending = %v, want %v", got, want)
+	}
+}
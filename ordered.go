@@ -0,0 +1,133 @@
+package camembert
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+// marshalFields encodes the fields of issue as a JSON object. With
+// Config.PreserveFieldOrder, the raw fields returned by Jira are kept on the
+// issue and objects are written with their keys in the order Jira sent them,
+// keys added since then coming last in sorted order. Unchanged values are
+// written exactly as received. Otherwise keys are sorted.
+func marshalFields(issue JiraIssue) ([]byte, error) {
+	if issue.rawFields == nil {
+		return json.Marshal(issue.Fields)
+	}
+	var buf bytes.Buffer
+	if err := appendOrdered(&buf, issue.Fields, issue.rawFields); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// appendOrdered writes value to buf, following raw, its form as returned by
+// Jira, for the order of object keys.
+func appendOrdered(buf *bytes.Buffer, value interface{}, raw json.RawMessage) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys, members := rawObject(raw)
+		var added []string
+		for key := range v {
+			if _, ok := members[key]; !ok {
+				added = append(added, key)
+			}
+		}
+		sort.Strings(added)
+
+		buf.WriteByte('{')
+		first := true
+		for _, key := range append(keys, added...) {
+			nested, ok := v[key]
+			if !ok {
+				continue
+			}
+			if !first {
+				buf.WriteByte(',')
+			}
+			first = false
+			name, _ := json.Marshal(key)
+			buf.Write(name)
+			buf.WriteByte(':')
+			if err := appendOrdered(buf, nested, members[key]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+		return nil
+	case []interface{}:
+		elements := rawArray(raw)
+		buf.WriteByte('[')
+		for i, nested := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			var element json.RawMessage
+			if i < len(elements) {
+				element = elements[i]
+			}
+			if err := appendOrdered(buf, nested, element); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	}
+
+	if raw != nil {
+		// Decoded scalars are comparable, so value may be compared with
+		// whatever type it holds.
+		var original interface{}
+		if err := decodeJSON(raw, &original); err == nil && original == value {
+			buf.Write(raw)
+			return nil
+		}
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	buf.Write(data)
+	return nil
+}
+
+// rawObject returns the keys of the JSON object raw in order, with their raw
+// values. Anything but an object has no keys.
+func rawObject(raw json.RawMessage) ([]string, map[string]json.RawMessage) {
+	if raw == nil {
+		return nil, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil, nil
+	}
+	var keys []string
+	members := make(map[string]json.RawMessage)
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, nil
+		}
+		key, _ := token.(string)
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return nil, nil
+		}
+		if _, ok := members[key]; !ok {
+			keys = append(keys, key)
+		}
+		members[key] = value
+	}
+	return keys, members
+}
+
+// rawArray returns the raw elements of the JSON array raw. Anything but an
+// array has no elements.
+func rawArray(raw json.RawMessage) []json.RawMessage {
+	var elements []json.RawMessage
+	if raw == nil || json.Unmarshal(raw, &elements) != nil {
+		return nil
+	}
+	return elements
+}
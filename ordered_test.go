@@ -0,0 +1,63 @@
+package camembert
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPreserveFieldOrder(t *testing.T) {
+	const value = `{"zeta": 1.50, "alpha": {"y": "b", "x": "a"}}`
+	tests := []struct {
+		name     string
+		preserve bool
+		want     string
+	}{
+		{name: "sorted", want: `"customfield_1":{"alpha":{"x":"a","y":"b"},"zeta":1.50}`},
+		{name: "preserved", preserve: true, want: `"customfield_1":{"zeta":1.50,"alpha":{"y":"b","x":"a"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			csvFile, dbFile := filepath.Join(dir, "issues.csv"), filepath.Join(dir, "issues.db")
+			cfg := (&fakeJira{total: 1, fields: map[string]json.RawMessage{"customfield_1": json.RawMessage(value)}}).start(t)
+			cfg.CSV = &CSVOutput{File: csvFile}
+			cfg.DB = &DBOutput{File: dbFile, Table: "issues"}
+			cfg.PreserveFieldOrder = tt.preserve
+			if _, err := Export(context.Background(), cfg); err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := os.Open(csvFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			records, err := csv.NewReader(f).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 2 || !strings.Contains(records[1][2], tt.want) {
+				t.Errorf("CSV = %q, want fields with %s", records, tt.want)
+			}
+
+			db, err := sql.Open("sqlite3", dbFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			var fields string
+			if err := db.QueryRow("SELECT fields FROM issues").Scan(&fields); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(fields, tt.want) {
+				t.Errorf("DB fields = %s, want %s", fields, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package camembert
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Stage transforms a batch of issues on its way from Jira to the outputs: all
+// the issues, or a page when streaming. It returns the issues to write, which
+// may be fewer than it was handed, and may modify them in place. Stages are
+// applied to one batch at a time, in order, and need no locking.
+type Stage func(ctx context.Context, issues []JiraIssue) ([]JiraIssue, error)
+
+// pipeline returns the stages applied to every batch: the configured checks
+// and duplicate removal, the collection of the users, sprints, labels,
+// components, visibility, fields and epics of the remaining issues,
+// Config.Stages, then the column profile of the issues written. References
+// are collected from the fields as Jira returned them, before stages such as
+// FlattenFields reshape them, so issues dropped by a stage still contribute
+// theirs. The profile describes the columns written, after the stages.
+func (e *exporter) pipeline() []Stage {
+	stages := []Stage{
+		func(ctx context.Context, issues []JiraIssue) ([]JiraIssue, error) {
+			return e.checkIssues(issues)
+		},
+		func(ctx context.Context, issues []JiraIssue) ([]JiraIssue, error) {
+			return e.dropDuplicates(issues)
+		},
+		e.collectReferences,
+	}
+	stages = append(stages, e.cfg.Stages...)
+	if e.profile != nil {
+		stages = append(stages, func(ctx context.Context, issues []JiraIssue) ([]JiraIssue, error) {
+			e.addProfile(issues)
+			return issues, nil
+		})
+	}
+	return stages
+}
+
+// collectReferences records the users, sprints, labels, components, comment
+// and worklog visibility and fields of issues and adds their epics.
+func (e *exporter) collectReferences(ctx context.Context, issues []JiraIssue) ([]JiraIssue, error) {
+	if e.users != nil {
+		e.users.add(issues)
+	}
+	if e.cfg.Sprints != nil {
+		e.addSprints(issues)
+	}
+	if e.cfg.ChildTables != nil {
+		e.addChildren(issues)
+	}
+	if e.cfg.Visibility != nil {
+		e.addVisibility(issues)
+	}
+	if e.observedFields != nil {
+		e.addObservedFields(issues)
+	}
+	if e.cfg.Epics != nil {
+		if err := e.addEpics(ctx, issues); err != nil {
+			return nil, err
+		}
+	}
+	return issues, nil
+}
+
+type exporterKey struct{}
+
+// stageExporter returns the exporter running the stage called with ctx.
+func stageExporter(ctx context.Context) (*exporter, error) {
+	e, ok := ctx.Value(exporterKey{}).(*exporter)
+	if !ok {
+		return nil, errors.New("stage called outside of an export")
+	}
+	return e, nil
+}
+
+// FlattenFields returns a stage replacing every object field value with one
+// field per leaf, named after its dotted path, such as status.name. Arrays are
+// kept as they are. Field mappings then name the flattened fields.
+func FlattenFields() Stage {
+	return func(ctx context.Context, issues []JiraIssue) ([]JiraIssue, error) {
+		for i := range issues {
+			flat := make(map[string]interface{}, len(issues[i].Fields))
+			flattenInto(flat, "", issues[i].Fields)
+			issues[i].Fields = flat
+		}
+		return issues, nil
+	}
+}
+
+func flattenInto(flat map[string]interface{}, prefix string, object map[string]interface{}) {
+	for name, value := range object {
+		if nested, ok := value.(map[string]interface{}); ok && len(nested) > 0 {
+			flattenInto(flat, prefix+name+".", nested)
+			continue
+		}
+		flat[prefix+name] = value
+	}
+}
+
+// jiraTimeLayout is the layout of the timestamps returned by Jira.
+const jiraTimeLayout = "2006-01-02T15:04:05.000-0700"
+
+// NormalizeDates returns a stage rewriting every timestamp in the issue
+// fields, at any depth, with layout in loc, such as time.RFC3339 in
+// time.UTC. Date-only values are left as they are.
+func NormalizeDates(layout string, loc *time.Location) Stage {
+	return func(ctx context.Context, issues []JiraIssue) ([]JiraIssue, error) {
+		for i := range issues {
+			for name, value := range issues[i].Fields {
+				issues[i].Fields[name] = normalizeDates(value, layout, loc)
+			}
+		}
+		return issues, nil
+	}
+}
+
+func normalizeDates(value interface{}, layout string, loc *time.Location) interface{} {
+	switch v := value.(type) {
+	case string:
+		if t, err := time.Parse(jiraTimeLayout, v); err == nil {
+			return t.In(loc).Format(layout)
+		}
+	case map[string]interface{}:
+		for name, nested := range v {
+			v[name] = normalizeDates(nested, layout, loc)
+		}
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = normalizeDates(nested, layout, loc)
+		}
+	}
+	return value
+}
+
+// ResolveFieldNames returns a stage renaming the fields of every issue after
+// their names, read from the field endpoint once per export. Fields keep
+// their IDs when the endpoint cannot be read, unless Config.RequireFieldNames
+// is set. Field mappings then name the fields by name.
+func ResolveFieldNames() Stage {
+	return func(ctx context.Context, issues []JiraIssue) ([]JiraIssue, error) {
+		e, err := stageExporter(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if e.fieldNames == nil {
+			if err := e.resolveFieldNames(ctx); err != nil {
+				return nil, err
+			}
+			if e.fieldNames == nil {
+				e.fieldNames = make(map[string]string)
+			}
+		}
+		for i := range issues {
+			named := make(map[string]interface{}, len(issues[i].Fields))
+			for id, value := range issues[i].Fields {
+				if name, ok := e.fieldNames[id]; ok {
+					id = name
+				}
+				named[id] = value
+			}
+			issues[i].Fields = named
+		}
+		return issues, nil
+	}
+}
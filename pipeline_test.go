@@ -0,0 +1,46 @@
+package camembert
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestPipelineCollectsBeforeStages checks that references are collected from
+// the fields as Jira returned them, while the profile describes the columns
+// written after the stages.
+func TestPipelineCollectsBeforeStages(t *testing.T) {
+	dir := t.TempDir()
+	usersFile, profileFile := filepath.Join(dir, "users.csv"), filepath.Join(dir, "profile.json")
+	jira := &fakeJira{total: 6, edit: func(i int, issue map[string]interface{}) {
+		issue["fields"].(map[string]interface{})["assignee"] = map[string]interface{}{
+			"accountId":   fmt.Sprintf("user-%d", i%3),
+			"displayName": fmt.Sprintf("User %d", i%3),
+		}
+	}}
+	cfg := jira.start(t)
+	cfg.Stages = []Stage{FlattenFields()}
+	cfg.CSV = &CSVOutput{File: filepath.Join(dir, "issues.csv"), Fields: []FieldMapping{{Field: "assignee.displayName", Column: "assignee"}}}
+	cfg.Users = &UsersOutput{CSVFile: usersFile}
+	cfg.ProfileFile = profileFile
+	if _, err := Export(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(usersFile)
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 4 {
+		t.Errorf("users file = %q, want the 3 assignees", data)
+	}
+	data, _ = os.ReadFile(profileFile)
+	var profile Profile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		t.Fatal(err)
+	}
+	if len(profile.Columns) != 1 || profile.Columns[0].Nulls != 0 || profile.Columns[0].Distinct != 3 {
+		t.Errorf("profile = %+v, want the 3 flattened assignee names", profile)
+	}
+}
@@ -0,0 +1,217 @@
+package camembert
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// maxProfileValues bounds the distinct values counted per profiled column.
+// Columns holding more report a lower bound in ColumnProfile.Distinct.
+const maxProfileValues = 10000
+
+// topProfileValues is the number of most frequent values reported for text
+// columns.
+const topProfileValues = 5
+
+// Profile describes the issues written by an export, column by column, for
+// data quality monitoring across runs: a field renamed upstream, for
+// example, shows up as a column suddenly holding nulls only.
+type Profile struct {
+	Issues  int             `json:"issues"`
+	Columns []ColumnProfile `json:"columns"`
+}
+
+// ColumnProfile describes the values of a column of the CSV or DB output.
+// Type is number or date when every value is one, and text otherwise. Min and
+// Max are only set for numbers and dates, Top only for text.
+type ColumnProfile struct {
+	Column string `json:"column"`
+	Field  string `json:"field"`
+	Type   string `json:"type,omitempty"`
+	Nulls  int    `json:"nulls"`
+	// Distinct is the number of distinct values besides null, capped at
+	// 10000, in which case DistinctCapped is set.
+	Distinct       int          `json:"distinct"`
+	DistinctCapped bool         `json:"distinctCapped,omitempty"`
+	Min            string       `json:"min,omitempty"`
+	Max            string       `json:"max,omitempty"`
+	Top            []ValueCount `json:"top,omitempty"`
+}
+
+// ValueCount is a value of a column and the number of issues holding it.
+type ValueCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// profileLayouts are the layouts of the values profiled as dates.
+var profileLayouts = []string{jiraTimeLayout, time.RFC3339Nano, "2006-01-02"}
+
+// columnStats accumulates the profile of a column as issues are written.
+type columnStats struct {
+	mapping FieldMapping
+	nulls   int
+	values  int
+	counts  map[string]int
+	capped  bool
+	// numbers and dates are cleared by the first value of another type.
+	numbers, dates   bool
+	minNumber        numberBound
+	maxNumber        numberBound
+	minDate, maxDate dateBound
+}
+
+// numberBound and dateBound are bounds of the values of a column, with the
+// value they were read from.
+type numberBound struct {
+	parsed float64
+	value  string
+}
+
+type dateBound struct {
+	parsed time.Time
+	value  string
+}
+
+// profileMappings returns the columns of the CSV and DB outputs, each once.
+func (c Config) profileMappings() []FieldMapping {
+	var mappings []FieldMapping
+	seen := make(map[string]bool)
+	for _, output := range [][]FieldMapping{csvFields(c.CSV), dbFields(c.DB)} {
+		for _, m := range output {
+			if !seen[m.column()] {
+				seen[m.column()] = true
+				mappings = append(mappings, m)
+			}
+		}
+	}
+	return mappings
+}
+
+func csvFields(output *CSVOutput) []FieldMapping {
+	if output == nil {
+		return nil
+	}
+	return output.Fields
+}
+
+func dbFields(output *DBOutput) []FieldMapping {
+	if output == nil {
+		return nil
+	}
+	return output.Fields
+}
+
+func newColumnStats(mappings []FieldMapping) []*columnStats {
+	stats := make([]*columnStats, len(mappings))
+	for i, m := range mappings {
+		stats[i] = &columnStats{mapping: m, counts: make(map[string]int), numbers: true, dates: true}
+	}
+	return stats
+}
+
+// addProfile records the column values of issues.
+func (e *exporter) addProfile(issues []JiraIssue) {
+	e.profiled += len(issues)
+	for _, s := range e.profile {
+		for _, issue := range issues {
+			s.add(fieldValue(issue.Fields, s.mapping.Field))
+		}
+	}
+}
+
+func (s *columnStats) add(value string) {
+	if value == "" {
+		s.nulls++
+		return
+	}
+	if _, ok := s.counts[value]; ok || len(s.counts) < maxProfileValues {
+		s.counts[value]++
+	} else {
+		s.capped = true
+	}
+
+	first := s.values == 0
+	s.values++
+	if s.numbers {
+		if n, err := strconv.ParseFloat(value, 64); err != nil {
+			s.numbers = false
+		} else {
+			if first || n < s.minNumber.parsed {
+				s.minNumber = numberBound{n, value}
+			}
+			if first || n > s.maxNumber.parsed {
+				s.maxNumber = numberBound{n, value}
+			}
+		}
+	}
+	if s.dates {
+		if t, ok := parseProfileDate(value); !ok {
+			s.dates = false
+		} else {
+			if first || t.Before(s.minDate.parsed) {
+				s.minDate = dateBound{t, value}
+			}
+			if first || t.After(s.maxDate.parsed) {
+				s.maxDate = dateBound{t, value}
+			}
+		}
+	}
+}
+
+func parseProfileDate(value string) (time.Time, bool) {
+	for _, layout := range profileLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (s *columnStats) profile() ColumnProfile {
+	p := ColumnProfile{
+		Column:         s.mapping.column(),
+		Field:          s.mapping.Field,
+		Nulls:          s.nulls,
+		Distinct:       len(s.counts),
+		DistinctCapped: s.capped,
+	}
+	switch {
+	case s.values == 0:
+	case s.numbers:
+		p.Type, p.Min, p.Max = "number", s.minNumber.value, s.maxNumber.value
+	case s.dates:
+		p.Type, p.Min, p.Max = "date", s.minDate.value, s.maxDate.value
+	default:
+		p.Type = "text"
+		for value, count := range s.counts {
+			p.Top = append(p.Top, ValueCount{Value: value, Count: count})
+		}
+		sort.Slice(p.Top, func(i, j int) bool {
+			if p.Top[i].Count != p.Top[j].Count {
+				return p.Top[i].Count > p.Top[j].Count
+			}
+			return p.Top[i].Value < p.Top[j].Value
+		})
+		if len(p.Top) > topProfileValues {
+			p.Top = p.Top[:topProfileValues]
+		}
+	}
+	return p
+}
+
+func (e *exporter) saveProfile(file string) error {
+	e.logger.Printf("Saving column profile to %s", file)
+	profile := Profile{Issues: e.profiled, Columns: []ColumnProfile{}}
+	for _, s := range e.profile {
+		profile.Columns = append(profile.Columns, s.profile())
+	}
+	profileJSON, err := json.MarshalIndent(profile, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(profileJSON, '\n'), 0o666)
+}
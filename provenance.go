@@ -0,0 +1,49 @@
+package camembert
+
+import (
+	"net/url"
+	"time"
+)
+
+// provenanceColumns are the columns added by Config.Provenance.
+var provenanceColumns = []string{"source_url", "fetched_at"}
+
+// stampProvenance records on issues the URL of the request they were fetched
+// with, credentials redacted, and the time its response was received.
+func (e *exporter) stampProvenance(issues []JiraIssue, rawURL string, query url.Values) {
+	if !e.cfg.Provenance {
+		return
+	}
+	source := provenanceURL(rawURL, query)
+	fetchedAt := time.Now().UTC()
+	for i := range issues {
+		issues[i].SourceURL = source
+		issues[i].FetchedAt = fetchedAt
+	}
+}
+
+// provenanceURL returns the URL getJSON requests for rawURL and query, with
+// its user information redacted.
+func provenanceURL(rawURL string, query url.Values) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	if u.User != nil {
+		u.User = url.User(redacted)
+	}
+	q := u.Query()
+	for name, values := range query {
+		q[name] = append(q[name], values...)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// fetchedAt formats the fetch time of issue for the outputs.
+func fetchedAt(issue JiraIssue) string {
+	if issue.FetchedAt.IsZero() {
+		return ""
+	}
+	return issue.FetchedAt.Format(time.RFC3339Nano)
+}
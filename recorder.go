@@ -0,0 +1,82 @@
+package camembert
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// redacted replaces the value of secret headers in recorded requests.
+const redacted = "REDACTED"
+
+// RecordedRequest is an outbound request captured by a RequestRecorder.
+type RecordedRequest struct {
+	Method string
+	// URL is the request URL without its query.
+	URL   string
+	Query url.Values
+	// Header holds the request headers, with the values of authentication
+	// headers replaced by REDACTED.
+	Header http.Header
+}
+
+// RequestRecorder captures every request sent by the exports it is set on,
+// so that tests can assert the exact JQL, fields, expand and pagination
+// parameters sent for a configuration. It is safe for concurrent use.
+type RequestRecorder struct {
+	mu       sync.Mutex
+	requests []RecordedRequest
+}
+
+// Requests returns the requests recorded so far, in the order they were sent.
+func (r *RequestRecorder) Requests() []RecordedRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RecordedRequest(nil), r.requests...)
+}
+
+// Reset forgets the recorded requests.
+func (r *RequestRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = nil
+}
+
+func (r *RequestRecorder) record(req *http.Request) {
+	endpoint := *req.URL
+	endpoint.RawQuery = ""
+	recorded := RecordedRequest{
+		Method: req.Method,
+		URL:    endpoint.String(),
+		Query:  req.URL.Query(),
+		Header: redactHeader(req.Header),
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, recorded)
+}
+
+// isSecretHeader reports whether the header name carries credentials.
+func isSecretHeader(name string) bool {
+	name = strings.ToLower(name)
+	switch name {
+	case "authorization", "proxy-authorization", "cookie":
+		return true
+	}
+	return strings.Contains(name, "token") || strings.Contains(name, "secret") || strings.Contains(name, "api-key")
+}
+
+// redactHeader returns a copy of header with secret values redacted.
+func redactHeader(header http.Header) http.Header {
+	clean := header.Clone()
+	for name, values := range clean {
+		if isSecretHeader(name) {
+			for i := range values {
+				values[i] = redacted
+			}
+		}
+	}
+	return clean
+}
@@ -0,0 +1,182 @@
+package camembert
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRequestRecorder(t *testing.T) {
+	recorder := &RequestRecorder{}
+	cfg := (&fakeJira{total: 2500}).start(t)
+	cfg.Headers["X-Api-Token"] = "secret"
+	cfg.Headers["Accept"] = "application/json"
+	cfg.Fields = []string{"summary"}
+	cfg.NoSafetyFields = true
+	cfg.Expand = []string{"names"}
+	cfg.Recorder = recorder
+	cfg.Writers = []Writer{&keyWriter{}}
+	if _, err := Export(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := recorder.Requests()
+	var startAts []string
+	for _, req := range requests {
+		startAts = append(startAts, req.Query.Get("startAt"))
+		if req.Method != "GET" || req.URL != cfg.JiraBaseURL {
+			t.Errorf("request %s %s, want GET %s", req.Method, req.URL, cfg.JiraBaseURL)
+		}
+		want := url.Values{
+			"jql":        {"project=P"},
+			"startAt":    {req.Query.Get("startAt")},
+			"maxResults": {strconv.Itoa(pageSize)},
+			"fields":     {"summary"},
+			"expand":     {"names"},
+		}
+		if !reflect.DeepEqual(req.Query, want) {
+			t.Errorf("query = %v, want %v", req.Query, want)
+		}
+		for name, want := range map[string]string{"Authorization": redacted, "X-Api-Token": redacted, "Accept": "application/json"} {
+			if got := req.Header.Get(name); got != want {
+				t.Errorf("header %s = %q, want %q", name, got, want)
+			}
+		}
+	}
+	sort.Strings(startAts)
+	if want := []string{"0", "1000", "2000"}; !reflect.DeepEqual(startAts, want) {
+		t.Errorf("startAt of the requests = %v, want %v", startAts, want)
+	}
+
+	recorder.Reset()
+	if got := recorder.Requests(); len(got) != 0 {
+		t.Errorf("Requests() after Reset = %d requests, want none", len(got))
+	}
+}
+
+func TestRequestRecorderKeyChunks(t *testing.T) {
+	keys := func(n int, format string) []string {
+		var keys []string
+		for i := 0; i < n; i++ {
+			keys = append(keys, fmt.Sprintf(format, i))
+		}
+		return keys
+	}
+	tests := []struct {
+		name string
+		keys []string
+		// want are the keys of every query, in order.
+		want [][]string
+	}{
+		{
+			name: "by count",
+			keys: keys(250, "P-%d"),
+			want: [][]string{keys(250, "P-%d")[:100], keys(250, "P-%d")[100:200], keys(250, "P-%d")[200:]},
+		},
+		{
+			// Quoted with their separator, 80 keys make 4000 bytes.
+			name: "by length",
+			keys: keys(150, "PROJECTWITHAVERYLONGKEYFORTESTINGCHUNKS-%07d"),
+			want: [][]string{keys(150, "PROJECTWITHAVERYLONGKEYFORTESTINGCHUNKS-%07d")[:80], keys(150, "PROJECTWITHAVERYLONGKEYFORTESTINGCHUNKS-%07d")[80:]},
+		},
+		{
+			name: "blank and repeated",
+			keys: []string{"P-1", " ", "P-2", " P-1 "},
+			want: [][]string{{"P-1", "P-2"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &RequestRecorder{}
+			cfg := (&fakeJira{total: 0}).start(t)
+			cfg.ProjectKey = ""
+			cfg.IssueKeys = tt.keys
+			cfg.Recorder = recorder
+			cfg.Writers = []Writer{&keyWriter{}}
+			if _, err := Export(context.Background(), cfg); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, req := range recorder.Requests() {
+				got = append(got, req.Query.Get("jql"))
+			}
+			sort.Strings(got)
+			var want []string
+			for _, chunk := range tt.want {
+				want = append(want, `key IN ("`+strings.Join(chunk, `","`)+`")`)
+			}
+			sort.Strings(want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("queries = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestKeysJQLQuoting(t *testing.T) {
+	got := keysJQL([]string{`P-1`, `P-"2"`, `P-\3`, `P-'4`})
+	if want := `key IN ("P-1","P-\"2\"","P-\\3","P-'4")`; got != want {
+		t.Errorf("keysJQL() = %s, want %s", got, want)
+	}
+}
+
+// TestRequestRecorderReplay replays the requests recorded for an export
+// against another Jira, with the credentials put back, and checks that they
+// select exactly the issues exported.
+func TestRequestRecorderReplay(t *testing.T) {
+	recorder := &RequestRecorder{}
+	cfg := (&fakeJira{total: 1500, limit: 400}).start(t)
+	cfg.Recorder = recorder
+	writer := &keyWriter{}
+	cfg.Writers = []Writer{writer}
+	if _, err := Export(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	replay := (&fakeJira{total: 1500, limit: 400}).start(t)
+	var replayed []string
+	for _, recorded := range recorder.Requests() {
+		target, _ := url.Parse(replay.JiraBaseURL)
+		target.RawQuery = recorded.Query.Encode()
+		req, err := http.NewRequest(recorded.Method, target.String(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header = recorded.Header.Clone()
+		for name := range req.Header {
+			if isSecretHeader(name) {
+				req.Header.Set(name, replay.Headers[name])
+			}
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var page JiraResponse
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, issue := range page.Issues {
+			replayed = append(replayed, issue.Key)
+		}
+	}
+
+	sort.Strings(replayed)
+	sort.Strings(writer.keys)
+	if !reflect.DeepEqual(replayed, writer.keys) {
+		t.Errorf("replayed %d issues, %s, want the %d exported", len(replayed), strings.Join(replayed[:min(5, len(replayed))], ","), len(writer.keys))
+	}
+	if len(writer.keys) != 1500 {
+		t.Errorf("exported %d issues, want 1500", len(writer.keys))
+	}
+}
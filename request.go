@@ -0,0 +1,86 @@
+package camembert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// StatusError is returned when Jira answers a request with a non-2xx status.
+type StatusError struct {
+	URL        string
+	StatusCode int
+	// RetryAfter is the delay requested by a Retry-After header, if any.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s returned status %d %s", e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// siteURL returns the root of the Jira site the configured search endpoint
+// belongs to, so that other REST resources can be addressed.
+func (c Config) siteURL() string {
+	if i := strings.Index(c.JiraBaseURL, "/rest/"); i >= 0 {
+		return c.JiraBaseURL[:i]
+	}
+	return strings.TrimSuffix(c.JiraBaseURL, "/")
+}
+
+// getJSON sends an authenticated GET request to rawURL with query merged into
+// its existing parameters, and decodes the JSON response into v. Numbers are
+// decoded as json.Number so that large IDs and precise decimals keep their
+// original representation when written back out.
+func (e *exporter) getJSON(ctx context.Context, rawURL string, query url.Values, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return err
+	}
+
+	// Set headers for authentication
+	for name, value := range e.cfg.Headers {
+		req.Header.Set(name, value)
+	}
+	if e.cfg.SendRequestID && e.requestID != "" {
+		req.Header.Set("X-Request-Id", e.requestID)
+	}
+
+	q := req.URL.Query()
+	for name, values := range query {
+		q[name] = append(q[name], values...)
+	}
+	req.URL.RawQuery = q.Encode()
+	if e.cfg.Recorder != nil {
+		e.cfg.Recorder.record(req)
+	}
+
+	// Send request
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		endpoint := *req.URL
+		endpoint.RawQuery = ""
+		return &StatusError{URL: endpoint.String(), StatusCode: resp.StatusCode, RetryAfter: retryAfter(resp.Header.Get("Retry-After"))}
+	}
+
+	// Decode the response
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// decodeJSON decodes data into v the way getJSON does.
+func decodeJSON(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
@@ -0,0 +1,73 @@
+package camembert
+
+import "sync/atomic"
+
+// ExportResult summarizes an export run. Export returns it on failure too,
+// describing the work done before the export stopped.
+type ExportResult struct {
+	// Total is the number of issues reported by Jira, or -1 when unknown.
+	Total int
+	// Pages is the number of pages fetched.
+	Pages int
+	// FailedPages is the number of pages that could not be fetched. Their
+	// issues are missing from the outputs.
+	FailedPages int
+	// Written is the number of issues handed to the outputs.
+	Written int
+	// Skipped is the number of issues dropped by a policy, or left out of
+	// the CSV output because they were already present in it.
+	Skipped int
+	// Duplicates is the number of copies of issues dropped because the
+	// issue was returned more than once.
+	Duplicates int
+	// Retries is the number of page requests sent again after a failure.
+	Retries int
+	// RateLimited is the number of page requests Jira answered with 429.
+	RateLimited int
+	// Concurrency is the number of page requests sent in parallel at the end
+	// of the export, as chosen by Config.AutoConcurrency, or the number of
+	// workers without it.
+	Concurrency int
+	// Restricted is the number of comments and worklogs restricted to a
+	// role or group, Omitted the number Jira counted among the ones it
+	// embeds in issues but left out, presumably restricted, and Truncated
+	// the number beyond the ones Jira embeds in search results, with
+	// Config.Visibility.
+	Restricted int
+	Omitted    int
+	Truncated  int
+}
+
+// exportStats holds the counters of an export. They are updated from the
+// workers and the collector alike, so each one is atomic.
+type exportStats struct {
+	total       atomic.Int64
+	pages       atomic.Int64
+	failedPages atomic.Int64
+	written     atomic.Int64
+	skipped     atomic.Int64
+	duplicates  atomic.Int64
+	retries     atomic.Int64
+	rateLimited atomic.Int64
+	concurrency atomic.Int64
+	restricted  atomic.Int64
+	omitted     atomic.Int64
+	truncated   atomic.Int64
+}
+
+func (s *exportStats) result() ExportResult {
+	return ExportResult{
+		Total:       int(s.total.Load()),
+		Pages:       int(s.pages.Load()),
+		FailedPages: int(s.failedPages.Load()),
+		Written:     int(s.written.Load()),
+		Skipped:     int(s.skipped.Load()),
+		Duplicates:  int(s.duplicates.Load()),
+		Retries:     int(s.retries.Load()),
+		RateLimited: int(s.rateLimited.Load()),
+		Concurrency: int(s.concurrency.Load()),
+		Restricted:  int(s.restricted.Load()),
+		Omitted:     int(s.omitted.Load()),
+		Truncated:   int(s.truncated.Load()),
+	}
+}
@@ -0,0 +1,100 @@
+package camembert
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyJira answers the first request for every page with 429, and every
+// request for the page at failAt with 500.
+type flakyJira struct {
+	*fakeJira
+	failAt int
+
+	mu       sync.Mutex
+	attempts map[int]int
+}
+
+func (f *flakyJira) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	startAt, _ := strconv.Atoi(r.URL.Query().Get("startAt"))
+	f.mu.Lock()
+	f.attempts[startAt]++
+	attempt := f.attempts[startAt]
+	f.mu.Unlock()
+	switch {
+	case attempt == 1:
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	case startAt == f.failAt:
+		w.WriteHeader(http.StatusInternalServerError)
+	default:
+		f.fakeJira.ServeHTTP(w, r)
+	}
+}
+
+func TestExportResultCounters(t *testing.T) {
+	// 40 pages of 50 issues, among which every issue 7 of a hundred has no
+	// key and every issue 9 repeats the issue before it.
+	jira := &fakeJira{total: 2000, limit: 50, edit: func(i int, issue map[string]interface{}) {
+		switch i % 100 {
+		case 7:
+			issue["key"] = ""
+		case 9:
+			prev := fakeIssue(i - 1)
+			issue["id"], issue["key"] = prev["id"], prev["key"]
+		}
+	}}
+	cfg := serve(t, &flakyJira{fakeJira: jira, failAt: 1000, attempts: make(map[int]int)})
+	cfg.EmptyKey = PolicySkip
+	cfg.MaxRetries = 2
+	cfg.RetryBackoff = time.Millisecond
+	var retries, rateLimited atomic.Int64
+	cfg.OnRetry = func(int, int, error) { retries.Add(1) }
+	cfg.OnRateLimit = func(time.Duration) { rateLimited.Add(1) }
+	writer := &countingWriter{}
+	cfg.Writers = []Writer{writer}
+
+	result, err := Export(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The page at 1000 fails, taking issues 1007 and 1009 with it.
+	want := ExportResult{
+		Total:       2000,
+		Pages:       39,
+		FailedPages: 1,
+		Written:     1950 - 19 - 19,
+		Skipped:     19,
+		Duplicates:  19,
+		Retries:     41,
+		RateLimited: 40,
+		Concurrency: numWorkers,
+	}
+	if result != want {
+		t.Errorf("Export() result = %+v, want %+v", result, want)
+	}
+	if got := writer.issues.Load(); got != int64(result.Written) {
+		t.Errorf("issues handed to the writer = %d, want Written %d", got, result.Written)
+	}
+	if retries.Load() != int64(result.Retries) || rateLimited.Load() != int64(result.RateLimited) {
+		t.Errorf("callbacks counted %d retries and %d 429s, want %d and %d", retries.Load(), rateLimited.Load(), result.Retries, result.RateLimited)
+	}
+}
+
+// countingWriter counts the issues it is handed.
+type countingWriter struct {
+	issues atomic.Int64
+}
+
+func (w *countingWriter) WriteIssues(ctx context.Context, issues []JiraIssue) error {
+	w.issues.Add(int64(len(issues)))
+	return nil
+}
+
+func (w *countingWriter) Close() error { return nil }
+func (w *countingWriter) Abort() error { return nil }
@@ -0,0 +1,187 @@
+package camembert
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultRetryBackoff is the delay before the first retry when
+	// Config.RetryBackoff is not set. It doubles with every attempt.
+	defaultRetryBackoff = time.Second
+	// maxRetryBackoff caps the delay between two attempts.
+	maxRetryBackoff = 30 * time.Second
+)
+
+// retryable reports whether a failed request may succeed when sent again:
+// when Jira answered with one of the status codes below, or when the
+// connection failed or was cut short. Other errors, such as an invalid URL
+// or a response that is not JSON, would fail the same way again.
+func retryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		// A url.Error is a net.Error whatever its cause, so its cause is
+		// checked instead. EOF there is a connection closed by the server
+		// before the response.
+		if err = urlErr.Err; errors.Is(err, io.EOF) {
+			return true
+		}
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// retryAfter parses a Retry-After header, given in seconds or as a date.
+func retryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
+
+// backoff returns the delay before the given retry, attempt starting at 1.
+func (c Config) backoff(attempt int) time.Duration {
+	delay := c.RetryBackoff
+	if delay <= 0 {
+		delay = defaultRetryBackoff
+	}
+	for i := 1; i < attempt && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryBackoff)
+}
+
+// fetchPageWithRetries fetches the page at startAt, retrying failed requests
+// up to Config.MaxRetries times. A Retry-After header sent by Jira overrides
+// the backoff delay.
+func (e *exporter) fetchPageWithRetries(ctx context.Context, startAt int) (JiraResponse, error) {
+	for attempt := 1; ; attempt++ {
+		var window int
+		if e.tuner != nil {
+			var err error
+			if window, err = e.tuner.acquire(ctx); err != nil {
+				return JiraResponse{}, err
+			}
+		}
+		resp, err := e.source.fetchPage(ctx, e, startAt)
+		var statusErr *StatusError
+		rateLimited := errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusTooManyRequests
+		if e.tuner != nil {
+			e.tuner.release(window, rateLimited)
+		}
+		if err == nil {
+			return resp, nil
+		}
+
+		delay := e.cfg.backoff(attempt)
+		if rateLimited {
+			e.stats.rateLimited.Add(1)
+			if statusErr.RetryAfter > 0 {
+				delay = statusErr.RetryAfter
+			}
+			if e.cfg.OnRateLimit != nil {
+				retryAfter := statusErr.RetryAfter
+				e.events.post(func() { e.cfg.OnRateLimit(retryAfter) })
+			}
+		}
+		if attempt > e.cfg.MaxRetries || !retryable(err) || ctx.Err() != nil {
+			return JiraResponse{}, err
+		}
+
+		e.stats.retries.Add(1)
+		e.logger.Printf("Retrying issues at startAt %d in %s after attempt %d failed: %v", startAt, delay, attempt, err)
+		if e.cfg.OnRetry != nil {
+			e.events.post(func() { e.cfg.OnRetry(attempt, startAt, err) })
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return JiraResponse{}, ctx.Err()
+		}
+	}
+}
+
+// eventQueue runs the OnRetry and OnRateLimit callbacks one at a time, in
+// order, from its own goroutine, so that a slow callback never holds up the
+// workers. Events are queued without limit until delivered.
+type eventQueue struct {
+	mu      sync.Mutex
+	pending []func()
+	wake    chan struct{}
+	done    chan struct{}
+	closed  bool
+}
+
+func newEventQueue() *eventQueue {
+	q := &eventQueue{wake: make(chan struct{}, 1), done: make(chan struct{})}
+	go q.run()
+	return q
+}
+
+func (q *eventQueue) post(event func()) {
+	q.mu.Lock()
+	q.pending = append(q.pending, event)
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *eventQueue) run() {
+	defer close(q.done)
+	for {
+		q.mu.Lock()
+		events, closed := q.pending, q.closed
+		q.pending = nil
+		q.mu.Unlock()
+		for _, event := range events {
+			event()
+		}
+		if closed && len(events) == 0 {
+			return
+		}
+		if len(events) == 0 {
+			<-q.wake
+		}
+	}
+}
+
+// close waits for the queued events to be delivered.
+func (q *eventQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	<-q.done
+}
@@ -0,0 +1,56 @@
+package camembert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "429", err: &StatusError{StatusCode: http.StatusTooManyRequests}, want: true},
+		{name: "503", err: &StatusError{StatusCode: http.StatusServiceUnavailable}, want: true},
+		{name: "404", err: &StatusError{StatusCode: http.StatusNotFound}},
+		{name: "connection refused", err: &url.Error{Op: "Get", URL: "http://jira", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}, want: true},
+		{name: "connection closed", err: &url.Error{Op: "Get", URL: "http://jira", Err: io.EOF}, want: true},
+		{name: "truncated body", err: io.ErrUnexpectedEOF, want: true},
+		{name: "unsupported scheme", err: &url.Error{Op: "Get", URL: "jira", Err: errors.New("unsupported protocol scheme")}},
+		{name: "invalid JSON", err: &json.SyntaxError{}},
+		{name: "empty body", err: io.EOF},
+		{name: "cancelled", err: &url.Error{Op: "Get", URL: "http://jira", Err: context.Canceled}},
+		{name: "wrapped", err: fmt.Errorf("failed to fetch: %w", &StatusError{StatusCode: http.StatusBadGateway}), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryable(tt.err); got != tt.want {
+				t.Errorf("retryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportDoesNotRetryInvalidJSON(t *testing.T) {
+	var requests int
+	cfg := serve(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte("<html>"))
+	}))
+	cfg.Writers = []Writer{&keyWriter{}}
+	cfg.MaxRetries = 3
+	if _, err := Export(context.Background(), cfg); err == nil {
+		t.Fatal("Export() succeeded, want an error for the invalid first page")
+	}
+	if requests != 1 {
+		t.Errorf("the invalid page was requested %d times, want once", requests)
+	}
+}
@@ -0,0 +1,75 @@
+package camembert
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// SchemaCheck validates a value of every issue against a JSON schema before
+// the issue is written, to enforce a contract on custom fields.
+type SchemaCheck struct {
+	// Schema is the JSON schema document.
+	Schema []byte
+	// Field is the dotted path of the validated value, for example
+	// "customfield_10010". The whole fields object is validated when empty.
+	Field string
+	// Policy selects how issues failing validation are handled.
+	Policy Policy
+}
+
+// compiledSchema is a SchemaCheck ready to validate issues.
+type compiledSchema struct {
+	check  SchemaCheck
+	schema *jsonschema.Schema
+}
+
+// compileSchemas compiles the schemas of checks.
+func compileSchemas(checks []SchemaCheck) ([]compiledSchema, error) {
+	var compiled []compiledSchema
+	for i, check := range checks {
+		doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(check.Schema))
+		if err != nil {
+			return nil, fmt.Errorf("schema %d: invalid JSON: %w", i, err)
+		}
+		url := fmt.Sprintf("mem:///schema-%d.json", i)
+		compiler := jsonschema.NewCompiler()
+		if err := compiler.AddResource(url, doc); err != nil {
+			return nil, fmt.Errorf("schema %d: %w", i, err)
+		}
+		schema, err := compiler.Compile(url)
+		if err != nil {
+			return nil, fmt.Errorf("schema %d: %w", i, err)
+		}
+		compiled = append(compiled, compiledSchema{check: check, schema: schema})
+	}
+	return compiled, nil
+}
+
+// validate checks the value selected by s in the fields of issue.
+func (s compiledSchema) validate(issue JiraIssue) error {
+	var value interface{} = map[string]interface{}(issue.Fields)
+	if issue.Fields == nil {
+		value = map[string]interface{}{}
+	}
+	if s.check.Field != "" {
+		value = fieldAt(issue.Fields, s.check.Field)
+	}
+	err := s.schema.Validate(value)
+	if err == nil {
+		return nil
+	}
+	// Keep the indented causes only, on a single line
+	lines := strings.Split(err.Error(), "\n")
+	if len(lines) == 1 {
+		return err
+	}
+	causes := make([]string, 0, len(lines)-1)
+	for _, line := range lines[1:] {
+		causes = append(causes, strings.TrimLeft(strings.TrimSpace(line), "- "))
+	}
+	return errors.New(strings.Join(causes, "; "))
+}
@@ -0,0 +1,100 @@
+package camembert
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// FieldSnapshot records, for every export run, the fields found on the
+// exported issues, so that the schema drift of custom fields added, removed
+// or renamed over time can be reconciled across runs. The fields are listed
+// in the manifest, when Config.ManifestFile is set, and in Table.
+type FieldSnapshot struct {
+	// Table, when set, receives one row per run and field in the database
+	// of the DB output, keyed by the start time of the run. Rows of earlier
+	// runs are kept when the database is appended to, as with
+	// DBOutput.Append.
+	Table string
+}
+
+// ManifestField is a field found on the issues of an export run. Name is
+// empty when the field endpoint could not be read.
+type ManifestField struct {
+	ID     string `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Custom bool   `json:"custom,omitempty"`
+}
+
+// addObservedFields records the fields of issues.
+func (e *exporter) addObservedFields(issues []JiraIssue) {
+	for _, issue := range issues {
+		for name := range issue.Fields {
+			e.observedFields[name] = true
+		}
+	}
+}
+
+// snapshotFields lists the observed fields, sorted by ID, named after the
+// field endpoint when it can be read.
+func (e *exporter) snapshotFields(ctx context.Context) []ManifestField {
+	known := make(map[string]jiraField)
+	fields, err := e.fetchJiraFields(ctx)
+	if err != nil {
+		e.logger.Printf("Warning: failed to fetch field names, recording field IDs only: %v", err)
+	}
+	for _, field := range fields {
+		known[field.ID] = field
+	}
+
+	snapshot := make([]ManifestField, 0, len(e.observedFields))
+	for id := range e.observedFields {
+		snapshot = append(snapshot, ManifestField{ID: id, Name: known[id].Name, Custom: known[id].Custom})
+	}
+	sort.Slice(snapshot, func(i, j int) bool { return snapshot[i].ID < snapshot[j].ID })
+	return snapshot
+}
+
+func (e *exporter) saveFieldSnapshotToDB(startedAt time.Time, dbFile string, tableName string) error {
+	e.logger.Printf("Saving field snapshot to DB file %s in table %s.", dbFile, tableName)
+
+	db, err := e.openDB(dbFile)
+	if err != nil {
+		return err
+	}
+	defer e.releaseDB(db)
+
+	createTableSQL := fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s (
+		started_at TEXT,
+		request_id TEXT,
+		field_id TEXT,
+		name TEXT,
+		custom INTEGER,
+		PRIMARY KEY (started_at, field_id)
+	);`, tableName)
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin a transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(createTableSQL); err != nil {
+		return fmt.Errorf("failed to create the table in the database: %w", err)
+	}
+
+	insertSQL := fmt.Sprintf(`INSERT OR REPLACE INTO %s (started_at, request_id, field_id, name, custom) VALUES (?, ?, ?, ?, ?)`, tableName)
+	runAt := startedAt.UTC().Format(time.RFC3339Nano)
+	for _, f := range e.snapshot {
+		_, err := tx.Exec(insertSQL, runAt, e.requestID, f.ID, f.Name, f.Custom)
+		if err != nil {
+			return fmt.Errorf("could not insert values in the table: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit the transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package camembert
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFieldSnapshotTable(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "issues.db")
+	for range 2 {
+		cfg := (&fakeJira{total: 2}).start(t)
+		cfg.DB = &DBOutput{File: file, Table: "issues", Append: true}
+		cfg.FieldSnapshot = &FieldSnapshot{Table: "fields"}
+		if _, err := Export(context.Background(), cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db, err := sql.Open("sqlite3", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	rows, err := db.Query("SELECT field_id, count(DISTINCT started_at) FROM fields GROUP BY field_id ORDER BY field_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	got := make(map[string]int)
+	for rows.Next() {
+		var field string
+		var runs int
+		if err := rows.Scan(&field, &runs); err != nil {
+			t.Fatal(err)
+		}
+		got[field] = runs
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"status": 2, "summary": 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("runs per field = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,279 @@
+package camembert
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// legacySprintPrefix starts the serialized sprints returned by older Jira
+// versions, such as
+// com.atlassian.greenhopper.service.sprint.Sprint@1f2e[id=12,rapidViewId=3,state=CLOSED,name=Sprint 1,...]
+const legacySprintPrefix = "com.atlassian.greenhopper.service.sprint.Sprint@"
+
+// legacySprintAttr matches the start of an attribute of a serialized sprint.
+// Only known attribute names are matched because names and goals may
+// themselves contain commas.
+var legacySprintAttr = regexp.MustCompile(`(?:^|,)(id|rapidViewId|state|name|goal|startDate|endDate|completeDate|activatedDate|sequence|synced|autoStartStop|incompleteIssuesDestinationId)=`)
+
+// Sprint is a sprint an issue belongs to.
+type Sprint struct {
+	ID           int
+	BoardID      int
+	Name         string
+	State        string
+	Goal         string
+	StartDate    string
+	EndDate      string
+	CompleteDate string
+}
+
+// SprintsOutput configures the export of the sprints issues belong to, one
+// row per issue and sprint. The rows are saved once every issue has been
+// written, so they are held in memory for the whole export, streamed or not.
+type SprintsOutput struct {
+	// Field is the ID of the sprint custom field. When empty, the field is
+	// detected from the shape of the values, and issues holding sprints in
+	// several fields get the ones of the field with the lowest ID, with a
+	// warning.
+	Field string
+	// CSVFile, when set, receives the sprint rows.
+	CSVFile string
+	// Table, when set, is created in the database of the DB output.
+	Table string
+}
+
+// ParseSprints decodes the value of a sprint field, in either the legacy
+// serialized string form or the object form returned by newer Jira versions.
+// It reports false when value does not look like a sprint field.
+func ParseSprints(value interface{}) ([]Sprint, bool) {
+	items, ok := value.([]interface{})
+	if !ok || len(items) == 0 {
+		return nil, false
+	}
+
+	var sprints []Sprint
+	for _, item := range items {
+		switch v := item.(type) {
+		case string:
+			sprint, ok := parseLegacySprint(v)
+			if !ok {
+				return nil, false
+			}
+			sprints = append(sprints, sprint)
+		case map[string]interface{}:
+			if _, ok := v["state"]; !ok {
+				return nil, false
+			}
+			if _, ok := v["boardId"]; !ok {
+				return nil, false
+			}
+			sprints = append(sprints, Sprint{
+				ID:           sprintInt(v["id"]),
+				BoardID:      sprintInt(v["boardId"]),
+				Name:         sprintString(v["name"]),
+				State:        sprintString(v["state"]),
+				Goal:         sprintString(v["goal"]),
+				StartDate:    sprintString(v["startDate"]),
+				EndDate:      sprintString(v["endDate"]),
+				CompleteDate: sprintString(v["completeDate"]),
+			})
+		default:
+			return nil, false
+		}
+	}
+	return sprints, true
+}
+
+func parseLegacySprint(s string) (Sprint, bool) {
+	if !strings.HasPrefix(s, legacySprintPrefix) {
+		return Sprint{}, false
+	}
+	start := strings.Index(s, "[")
+	end := strings.LastIndex(s, "]")
+	if start < 0 || end < start {
+		return Sprint{}, false
+	}
+	body := s[start+1 : end]
+
+	attrs := make(map[string]string)
+	matches := legacySprintAttr.FindAllStringSubmatchIndex(body, -1)
+	for i, m := range matches {
+		valueEnd := len(body)
+		if i+1 < len(matches) {
+			valueEnd = matches[i+1][0]
+		}
+		value := body[m[1]:valueEnd]
+		if value == "<null>" {
+			value = ""
+		}
+		attrs[body[m[2]:m[3]]] = value
+	}
+
+	id, _ := strconv.Atoi(attrs["id"])
+	boardID, _ := strconv.Atoi(attrs["rapidViewId"])
+	return Sprint{
+		ID:           id,
+		BoardID:      boardID,
+		Name:         attrs["name"],
+		State:        attrs["state"],
+		Goal:         attrs["goal"],
+		StartDate:    attrs["startDate"],
+		EndDate:      attrs["endDate"],
+		CompleteDate: attrs["completeDate"],
+	}, true
+}
+
+func sprintString(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+func sprintInt(v interface{}) int {
+	switch n := v.(type) {
+	case json.Number:
+		i, _ := strconv.Atoi(n.String())
+		return i
+	case float64:
+		return int(n)
+	default:
+		return 0
+	}
+}
+
+// issueSprint is a row of the sprints output.
+type issueSprint struct {
+	issueID  string
+	issueKey string
+	Sprint
+}
+
+// sprintFields returns the custom fields of issue holding sprints, lowest ID
+// first.
+func sprintFields(issue JiraIssue) []string {
+	var fields []string
+	for name, value := range issue.Fields {
+		if !strings.HasPrefix(name, "customfield_") {
+			continue
+		}
+		if _, ok := ParseSprints(value); ok {
+			fields = append(fields, name)
+		}
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		if len(fields[i]) != len(fields[j]) {
+			return len(fields[i]) < len(fields[j])
+		}
+		return fields[i] < fields[j]
+	})
+	return fields
+}
+
+// issueSprints returns the sprints of issue, read from field or, when field
+// is empty, from the custom field with the lowest ID holding sprints, along
+// with the other fields holding sprints, which are left out.
+func issueSprints(issue JiraIssue, field string) ([]Sprint, []string) {
+	var others []string
+	if field == "" {
+		fields := sprintFields(issue)
+		if len(fields) == 0 {
+			return nil, nil
+		}
+		field, others = fields[0], fields[1:]
+	}
+	sprints, _ := ParseSprints(issue.Fields[field])
+	return sprints, others
+}
+
+func (e *exporter) addSprints(issues []JiraIssue) {
+	for _, issue := range issues {
+		sprints, others := issueSprints(issue, e.cfg.Sprints.Field)
+		if len(others) > 0 && !e.sprintFieldsWarned {
+			e.sprintFieldsWarned = true
+			e.logger.Printf("Warning: issue %s holds sprints in several fields, ignoring %s, set SprintsOutput.Field to choose the sprint field", issue.Key, strings.Join(others, ", "))
+		}
+		for _, sprint := range sprints {
+			e.sprints = append(e.sprints, issueSprint{issueID: issue.ID, issueKey: issue.Key, Sprint: sprint})
+		}
+	}
+}
+
+func (e *exporter) exportSprints(output SprintsOutput) error {
+	if output.CSVFile != "" {
+		if err := e.saveSprintsToCSV(output.CSVFile); err != nil {
+			return err
+		}
+	}
+	if output.Table != "" {
+		if err := e.saveSprintsToDB(e.cfg.DB.File, output.Table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *exporter) saveSprintsToCSV(csvFile string) error {
+	e.logger.Printf("Saving sprints to CSV file: %s", csvFile)
+	file, err := os.Create(csvFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	headers := []string{"IssueID", "IssueKey", "SprintID", "BoardID", "Name", "State", "Goal", "StartDate", "EndDate", "CompleteDate"}
+	if err := writer.Write(headers); err != nil {
+		return fmt.Errorf("failed to write CSV headers: %w", err)
+	}
+	for _, s := range e.sprints {
+		record := []string{s.issueID, s.issueKey, strconv.Itoa(s.ID), strconv.Itoa(s.BoardID), s.Name, s.State, s.Goal, s.StartDate, s.EndDate, s.CompleteDate}
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("failed to write data in CSV file: %w", err)
+		}
+	}
+	return nil
+}
+
+func (e *exporter) saveSprintsToDB(dbFile string, tableName string) error {
+	e.logger.Printf("Saving sprints to DB file %s in table %s.", dbFile, tableName)
+
+	db, err := e.openDB(dbFile)
+	if err != nil {
+		return err
+	}
+	defer e.releaseDB(db)
+
+	createTableSQL := fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s (
+		issue_id TEXT,
+		issue_key TEXT,
+		sprint_id INTEGER,
+		board_id INTEGER,
+		name TEXT,
+		state TEXT,
+		goal TEXT,
+		start_date TEXT,
+		end_date TEXT,
+		complete_date TEXT,
+		PRIMARY KEY (issue_id, sprint_id)
+	);`, tableName)
+	if _, err := db.Exec(createTableSQL); err != nil {
+		return fmt.Errorf("failed to create the table in the database: %w", err)
+	}
+
+	insertSQL := fmt.Sprintf(`INSERT OR REPLACE INTO %s (issue_id, issue_key, sprint_id, board_id, name, state, goal, start_date, end_date, complete_date) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, tableName)
+	for _, s := range e.sprints {
+		_, err := db.Exec(insertSQL, s.issueID, s.issueKey, s.ID, s.BoardID, s.Name, s.State, s.Goal, s.StartDate, s.EndDate, s.CompleteDate)
+		if err != nil {
+			return fmt.Errorf("could not insert values in the table: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package camembert
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseSprints(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  interface{}
+		want   []Sprint
+		wantOK bool
+	}{
+		{
+			name: "legacy",
+			value: []interface{}{
+				"com.atlassian.greenhopper.service.sprint.Sprint@1f2e[id=12,rapidViewId=3,state=CLOSED,name=Sprint 1,goal=<null>,startDate=2023-01-02T09:00:00.000Z,endDate=2023-01-16T09:00:00.000Z,completeDate=2023-01-16T10:00:00.000Z,sequence=12]",
+			},
+			want:   []Sprint{{ID: 12, BoardID: 3, Name: "Sprint 1", State: "CLOSED", StartDate: "2023-01-02T09:00:00.000Z", EndDate: "2023-01-16T09:00:00.000Z", CompleteDate: "2023-01-16T10:00:00.000Z"}},
+			wantOK: true,
+		},
+		{
+			name: "legacy with commas in the name and goal",
+			value: []interface{}{
+				"com.atlassian.greenhopper.service.sprint.Sprint@5a[id=13,rapidViewId=3,state=ACTIVE,name=Sprint 2, the big one,goal=Ship it, then rest,startDate=<null>,endDate=<null>,completeDate=<null>]",
+			},
+			want:   []Sprint{{ID: 13, BoardID: 3, Name: "Sprint 2, the big one", State: "ACTIVE", Goal: "Ship it, then rest"}},
+			wantOK: true,
+		},
+		{
+			name: "objects",
+			value: []interface{}{
+				map[string]interface{}{"id": json.Number("21"), "boardId": json.Number("4"), "name": "Sprint 3", "state": "closed", "goal": "", "startDate": "2024-03-01T09:00:00.000Z", "endDate": "2024-03-15T09:00:00.000Z", "completeDate": "2024-03-15T11:00:00.000Z"},
+				map[string]interface{}{"id": 22.0, "boardId": 4.0, "name": "Sprint 4", "state": "active"},
+			},
+			want: []Sprint{
+				{ID: 21, BoardID: 4, Name: "Sprint 3", State: "closed", StartDate: "2024-03-01T09:00:00.000Z", EndDate: "2024-03-15T09:00:00.000Z", CompleteDate: "2024-03-15T11:00:00.000Z"},
+				{ID: 22, BoardID: 4, Name: "Sprint 4", State: "active"},
+			},
+			wantOK: true,
+		},
+		{name: "empty", value: []interface{}{}},
+		{name: "null", value: nil},
+		{name: "labels", value: []interface{}{"backend", "urgent"}},
+		{name: "objects without a board", value: []interface{}{map[string]interface{}{"id": 1.0, "name": "Component", "state": "x"}}},
+		{name: "string", value: "com.atlassian.greenhopper.service.sprint.Sprint@1[id=1]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseSprints(tt.value)
+			if ok != tt.wantOK || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSprints() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestIssueSprintsDetection(t *testing.T) {
+	sprint := func(id int) []interface{} {
+		return []interface{}{map[string]interface{}{"id": float64(id), "boardId": 1.0, "state": "active"}}
+	}
+	issue := JiraIssue{Key: "P-1", Fields: map[string]interface{}{
+		"labels":            []interface{}{"backend"},
+		"customfield_10020": sprint(2),
+		"customfield_9000":  sprint(1),
+		"customfield_10100": []interface{}{"text"},
+	}}
+	tests := []struct {
+		name       string
+		field      string
+		wantID     int
+		wantOthers []string
+	}{
+		{name: "detected", wantID: 1, wantOthers: []string{"customfield_10020"}},
+		{name: "configured", field: "customfield_10020", wantID: 2},
+		{name: "missing", field: "customfield_1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Fields are a map: detection must not depend on its order.
+			for range 20 {
+				sprints, others := issueSprints(issue, tt.field)
+				gotID := 0
+				if len(sprints) > 0 {
+					gotID = sprints[0].ID
+				}
+				if gotID != tt.wantID || !reflect.DeepEqual(others, tt.wantOthers) {
+					t.Fatalf("issueSprints() = %+v, %v, want sprint %d, others %v", sprints, others, tt.wantID, tt.wantOthers)
+				}
+			}
+		})
+	}
+}
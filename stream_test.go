@@ -0,0 +1,75 @@
+package camembert
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingJira counts the page requests served by a fake Jira.
+type countingJira struct {
+	*fakeJira
+	served atomic.Int64
+}
+
+func (j *countingJira) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	j.served.Add(1)
+	j.fakeJira.ServeHTTP(w, r)
+}
+
+// slowWriter writes a page every delay and records the most pages fetched
+// but not yet written seen by any write.
+type slowWriter struct {
+	jira    *countingJira
+	delay   time.Duration
+	written int64
+	peak    int64
+}
+
+func (w *slowWriter) WriteIssues(ctx context.Context, issues []JiraIssue) error {
+	time.Sleep(w.delay)
+	w.peak = max(w.peak, w.jira.served.Load()-w.written)
+	w.written++
+	return nil
+}
+
+func (w *slowWriter) Close() error { return nil }
+func (w *slowWriter) Abort() error { return nil }
+
+func TestStreamBoundsPagesInFlight(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxInFlight int
+		// wantPeak bounds the pages held, counting the first page, fetched
+		// before the others are bounded.
+		wantPeak int64
+	}{
+		{name: "default", wantPeak: streamInFlight + 1},
+		{name: "MaxInFlight", maxInFlight: 3, wantPeak: 3 + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jira := &countingJira{fakeJira: &fakeJira{total: 100 * 50, limit: 50}}
+			cfg := serve(t, jira)
+			cfg.Stream = true
+			cfg.MaxInFlight = tt.maxInFlight
+			writer := &slowWriter{jira: jira, delay: time.Millisecond}
+			cfg.Writers = []Writer{writer}
+			result, err := Export(context.Background(), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Written != 100*50 || writer.written != 100 {
+				t.Errorf("wrote %d issues in %d pages, want 5000 in 100", result.Written, writer.written)
+			}
+			if writer.peak > tt.wantPeak {
+				t.Errorf("up to %d pages were held, want at most %d", writer.peak, tt.wantPeak)
+			}
+			if writer.peak < 2 {
+				t.Errorf("up to %d pages were held, want pages fetched while writing", writer.peak)
+			}
+		})
+	}
+}
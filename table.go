@@ -0,0 +1,115 @@
+package camembert
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ExportTableToCSV runs query against db and writes the resulting rows to out
+// as CSV, without contacting Jira. query defaults to selecting every row of
+// tableName. The fields column, named by base as DBOutput.Columns names it,
+// holds the JSON written by the DB output and is expanded into one column per
+// field, as CSVOutput.Flatten does, which requires every row to be read
+// before the first one is written.
+func ExportTableToCSV(db *sql.DB, tableName string, base BaseColumns, query string, out io.Writer) error {
+	if query == "" {
+		query = fmt.Sprintf(`SELECT * FROM %s`, tableName)
+	}
+	rows, err := db.Query(query)
+	if err != nil {
+		return fmt.Errorf("failed to query the table: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	fieldsColumn := -1
+	for i, column := range columns {
+		if column == base.fields() {
+			fieldsColumn = i
+		}
+	}
+
+	// Read every row, decoding the fields blob when there is one.
+	var records [][]string
+	var issues []JiraIssue
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+		record := make([]string, 0, len(columns))
+		for i, value := range values {
+			if i != fieldsColumn {
+				record = append(record, sqlValueString(value))
+			}
+		}
+		records = append(records, record)
+
+		if fieldsColumn >= 0 {
+			var fields map[string]interface{}
+			if blob := sqlValueString(values[fieldsColumn]); blob != "" {
+				if err := decodeJSON([]byte(blob), &fields); err != nil {
+					return fmt.Errorf("failed to decode fields of row %d: %w", len(records), err)
+				}
+			}
+			issues = append(issues, JiraIssue{Fields: fields})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(out)
+	headers := make([]string, 0, len(columns))
+	for i, column := range columns {
+		if i != fieldsColumn {
+			headers = append(headers, column)
+		}
+	}
+	names := fieldNames(issues)
+	headers = append(headers, names...)
+	if err := writer.Write(headers); err != nil {
+		return fmt.Errorf("failed to write CSV headers: %w", err)
+	}
+
+	for i, record := range records {
+		if fieldsColumn >= 0 {
+			for _, name := range names {
+				record = append(record, fieldValue(issues[i].Fields, name))
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("failed to write data in CSV file: %w", err)
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// sqlValueString renders a value scanned from SQLite as a CSV cell.
+func sqlValueString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,83 @@
+package camembert
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+func TestExportTableToCSV(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "issues.db")
+	cfg := (&fakeJira{total: 2, fields: map[string]json.RawMessage{"customfield_1": json.RawMessage("12345678901234567890")}}).start(t)
+	cfg.DB = &DBOutput{File: file, Table: "issues"}
+	if _, err := Export(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name: "table",
+			want: "id,key,customfield_1,status,summary\n" +
+				"10000,P-0,12345678901234567890,\"{\"\"name\"\":\"\"Open\"\"}\",issue 0\n" +
+				"10001,P-1,12345678901234567890,\"{\"\"name\"\":\"\"Open\"\"}\",issue 1\n",
+		},
+		{
+			name:  "query",
+			query: `SELECT key, fields FROM issues WHERE key = 'P-1'`,
+			want: "key,customfield_1,status,summary\n" +
+				"P-1,12345678901234567890,\"{\"\"name\"\":\"\"Open\"\"}\",issue 1\n",
+		},
+		{
+			name:  "query without fields",
+			query: `SELECT id, key FROM issues ORDER BY key DESC`,
+			want:  "id,key\n10001,P-1\n10000,P-0\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := ExportTableToCSV(db, "issues", BaseColumns{}, tt.query, &out); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("ExportTableToCSV() wrote\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportTableToCSVRenamedColumns(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "issues.db")
+	columns := BaseColumns{ID: "issue_id", Key: "issue_key", Fields: "payload"}
+	cfg := (&fakeJira{total: 1}).start(t)
+	cfg.DB = &DBOutput{File: file, Table: "issues", Columns: columns}
+	if _, err := Export(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var out bytes.Buffer
+	if err := ExportTableToCSV(db, "issues", columns, "", &out); err != nil {
+		t.Fatal(err)
+	}
+	want := "issue_id,issue_key,status,summary\n10000,P-0,\"{\"\"name\"\":\"\"Open\"\"}\",issue 0\n"
+	if got := out.String(); got != want {
+		t.Errorf("ExportTableToCSV() wrote\n%s\nwant\n%s", got, want)
+	}
+}
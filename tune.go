@@ -0,0 +1,114 @@
+package camembert
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// tuneGain is the throughput increase a window must show for the tuner to
+// keep raising the concurrency.
+const tuneGain = 1.05
+
+// concurrencyTuner limits the page requests in flight for
+// Config.AutoConcurrency. It starts with a single request and measures the
+// throughput over windows of as many requests as the current limit. The
+// limit grows by one after a window faster than the previous one, stays put
+// after a window that is not, and is halved on the first 429 response of a
+// window. It then never grows back to the limit that was rate limited.
+type concurrencyTuner struct {
+	logger *log.Logger
+
+	mu     sync.Mutex
+	limit  int
+	active int
+	// ceiling is the lowest limit rate limited so far.
+	ceiling int
+	// freed is closed, and replaced, whenever a slot may have become free.
+	freed chan struct{}
+	// windowStart and windowDone describe the current measuring window,
+	// rate the throughput of the previous one in requests per second.
+	// window is incremented by the first 429 of a window, so that the
+	// requests sent before, throttled or not, are left out of the window
+	// measured after.
+	window      int
+	windowStart time.Time
+	windowDone  int
+	rate        float64
+}
+
+func newConcurrencyTuner(logger *log.Logger, workers int) *concurrencyTuner {
+	return &concurrencyTuner{logger: logger, limit: 1, ceiling: workers + 1, freed: make(chan struct{})}
+}
+
+// acquire blocks until another request may be sent, or ctx is done. It
+// returns the window the request is sent in, to be passed to release.
+func (t *concurrencyTuner) acquire(ctx context.Context) (int, error) {
+	for {
+		t.mu.Lock()
+		if t.active < t.limit {
+			t.active++
+			if t.windowStart.IsZero() {
+				t.windowStart = time.Now()
+			}
+			window := t.window
+			t.mu.Unlock()
+			return window, nil
+		}
+		freed := t.freed
+		t.mu.Unlock()
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+// release frees the slot of a request sent in window, which Jira answered
+// with 429 when throttled is set, and adjusts the limit.
+func (t *concurrencyTuner) release(window int, throttled bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active--
+	defer t.wake()
+
+	if window != t.window {
+		// Sent before the last 429: a burst of 429s lowers the limit once.
+		return
+	}
+	if throttled {
+		t.ceiling = min(t.ceiling, t.limit)
+		if limit := max(1, t.limit/2); limit < t.limit {
+			t.logger.Printf("Rate limited, lowering concurrency to %d", limit)
+			t.limit = limit
+		}
+		t.window++
+		t.windowStart, t.windowDone, t.rate = time.Now(), 0, 0
+		return
+	}
+	t.windowDone++
+	if t.windowDone < t.limit {
+		return
+	}
+	rate := float64(t.windowDone) / time.Since(t.windowStart).Seconds()
+	if rate > t.rate*tuneGain && t.limit+1 < t.ceiling {
+		t.limit++
+		t.logger.Printf("Raising concurrency to %d", t.limit)
+	}
+	t.rate = rate
+	t.windowStart, t.windowDone = time.Now(), 0
+}
+
+func (t *concurrencyTuner) wake() {
+	close(t.freed)
+	t.freed = make(chan struct{})
+}
+
+// concurrency returns the current limit.
+func (t *concurrencyTuner) concurrency() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limit
+}
@@ -0,0 +1,87 @@
+package camembert
+
+import (
+	"context"
+	"log"
+	"testing"
+)
+
+func TestConcurrencyTunerThrottled(t *testing.T) {
+	tuner := newConcurrencyTuner(log.Default(), numWorkers)
+	tuner.limit = 4
+	var windows []int
+	for range 4 {
+		window, err := tuner.acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		windows = append(windows, window)
+	}
+
+	tuner.release(windows[0], true)
+	if got := tuner.concurrency(); got != 2 {
+		t.Fatalf("concurrency after a 429 = %d, want 2", got)
+	}
+	// The requests sent before the 429 complete right away: they must not
+	// be measured as a window after it.
+	for _, window := range windows[1:] {
+		tuner.release(window, false)
+	}
+	if got := tuner.concurrency(); got != 2 {
+		t.Errorf("concurrency after the requests sent before the 429 = %d, want 2", got)
+	}
+	if tuner.windowDone != 0 {
+		t.Errorf("window counts %d requests sent before the 429, want none", tuner.windowDone)
+	}
+
+	// A window of requests sent after the 429 may raise the limit again, but
+	// not back to the limit that was rate limited.
+	for range 3 {
+		for range tuner.concurrency() {
+			window, err := tuner.acquire(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			tuner.release(window, false)
+		}
+	}
+	if got := tuner.concurrency(); got != 3 {
+		t.Errorf("concurrency after windows sent after the 429 = %d, want 3", got)
+	}
+}
+
+func TestConcurrencyTunerThrottledBurst(t *testing.T) {
+	tuner := newConcurrencyTuner(log.Default(), numWorkers)
+	tuner.limit = 8
+	var windows []int
+	for range 8 {
+		window, err := tuner.acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		windows = append(windows, window)
+	}
+
+	// Every request of the window is rate limited: the limit is halved once.
+	for _, window := range windows {
+		tuner.release(window, true)
+	}
+	if got := tuner.concurrency(); got != 4 {
+		t.Fatalf("concurrency after a burst of 429s = %d, want 4", got)
+	}
+	if tuner.ceiling != 8 {
+		t.Errorf("ceiling after a burst of 429s = %d, want 8", tuner.ceiling)
+	}
+
+	// The first window sent after the 429s raises the limit again.
+	for range tuner.concurrency() {
+		window, err := tuner.acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		tuner.release(window, false)
+	}
+	if got := tuner.concurrency(); got != 5 {
+		t.Errorf("concurrency after a window sent after the 429s = %d, want 5", got)
+	}
+}
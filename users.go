@@ -0,0 +1,196 @@
+package camembert
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// userFields lists the issue fields whose users are exported.
+var userFields = []string{"assignee", "reporter", "creator"}
+
+// UsersOutput configures the export of the distinct users referenced by the
+// assignee, reporter and creator of the exported issues.
+type UsersOutput struct {
+	// CSVFile, when set, receives one row per user.
+	CSVFile string
+	// Table, when set, is created in the database of the DB output.
+	Table string
+}
+
+// JiraUser is a user profile as returned by the users endpoint.
+type JiraUser struct {
+	AccountID    string `json:"accountId"`
+	Key          string `json:"key"`
+	Name         string `json:"name"`
+	DisplayName  string `json:"displayName"`
+	EmailAddress string `json:"emailAddress"`
+	Active       bool   `json:"active"`
+	AccountType  string `json:"accountType"`
+}
+
+// id returns the identity of the user: the account ID on Jira Cloud and the
+// user key or name on Jira Server.
+func (u JiraUser) id() string {
+	switch {
+	case u.AccountID != "":
+		return u.AccountID
+	case u.Key != "":
+		return u.Key
+	default:
+		return u.Name
+	}
+}
+
+// userSet collects the users embedded in the user fields of issues, keyed by
+// identity.
+type userSet map[string]JiraUser
+
+func (s userSet) add(issues []JiraIssue) {
+	for _, issue := range issues {
+		for _, name := range userFields {
+			object, ok := issue.Fields[name].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			user := JiraUser{}
+			user.AccountID, _ = object["accountId"].(string)
+			user.Key, _ = object["key"].(string)
+			user.Name, _ = object["name"].(string)
+			user.DisplayName, _ = object["displayName"].(string)
+			user.EmailAddress, _ = object["emailAddress"].(string)
+			user.Active, _ = object["active"].(bool)
+			user.AccountType, _ = object["accountType"].(string)
+			if user.id() != "" {
+				s[user.id()] = user
+			}
+		}
+	}
+}
+
+// sorted returns the users of the set sorted by identity.
+func (s userSet) sorted() []JiraUser {
+	result := make([]JiraUser, 0, len(s))
+	for _, user := range s {
+		result = append(result, user)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].id() < result[j].id() })
+	return result
+}
+
+// fetchUser fetches the full profile of user. Users that no longer exist are
+// returned as embedded in the issues and marked inactive.
+func (e *exporter) fetchUser(ctx context.Context, user JiraUser) (JiraUser, error) {
+	q := url.Values{}
+	switch {
+	case user.AccountID != "":
+		q.Set("accountId", user.AccountID)
+	case user.Key != "":
+		q.Set("key", user.Key)
+	default:
+		q.Set("username", user.Name)
+	}
+
+	var profile JiraUser
+	err := e.getJSON(ctx, e.cfg.siteURL()+"/rest/api/2/user", q, &profile)
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		e.logger.Printf("User %s not found, it may have been deleted", user.id())
+		user.Active = false
+		return user, nil
+	}
+	if err != nil {
+		return JiraUser{}, err
+	}
+	return profile, nil
+}
+
+func (e *exporter) exportUsers(ctx context.Context, output UsersOutput) error {
+	referenced := e.users.sorted()
+	e.logger.Printf("Fetching %d users referenced by issues", len(referenced))
+
+	users := make([]JiraUser, 0, len(referenced))
+	for _, user := range referenced {
+		profile, err := e.fetchUser(ctx, user)
+		if err != nil {
+			return fmt.Errorf("failed to fetch user %s: %w", user.id(), err)
+		}
+		users = append(users, profile)
+	}
+
+	if output.CSVFile != "" {
+		if err := e.saveUsersToCSV(users, output.CSVFile); err != nil {
+			return err
+		}
+	}
+	if output.Table != "" {
+		if err := e.saveUsersToDB(users, e.cfg.DB.File, output.Table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *exporter) saveUsersToCSV(users []JiraUser, csvFile string) error {
+	e.logger.Printf("Saving users to CSV file: %s", csvFile)
+	file, err := os.Create(csvFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	headers := []string{"AccountID", "Key", "Name", "DisplayName", "EmailAddress", "Active", "AccountType"}
+	if err := writer.Write(headers); err != nil {
+		return fmt.Errorf("failed to write CSV headers: %w", err)
+	}
+	for _, u := range users {
+		record := []string{u.AccountID, u.Key, u.Name, u.DisplayName, u.EmailAddress, strconv.FormatBool(u.Active), u.AccountType}
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("failed to write data in CSV file: %w", err)
+		}
+	}
+	return nil
+}
+
+func (e *exporter) saveUsersToDB(users []JiraUser, dbFile string, tableName string) error {
+	e.logger.Printf("Saving users to DB file %s in table %s.", dbFile, tableName)
+
+	db, err := e.openDB(dbFile)
+	if err != nil {
+		return err
+	}
+	defer e.releaseDB(db)
+
+	createTableSQL := fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s (
+		id TEXT PRIMARY KEY,
+		account_id TEXT,
+		key TEXT,
+		name TEXT,
+		display_name TEXT,
+		email_address TEXT,
+		active INTEGER,
+		account_type TEXT
+	);`, tableName)
+	if _, err := db.Exec(createTableSQL); err != nil {
+		return fmt.Errorf("failed to create the table in the database: %w", err)
+	}
+
+	insertSQL := fmt.Sprintf(`INSERT OR REPLACE INTO %s (id, account_id, key, name, display_name, email_address, active, account_type) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, tableName)
+	for _, u := range users {
+		_, err := db.Exec(insertSQL, u.id(), u.AccountID, u.Key, u.Name, u.DisplayName, u.EmailAddress, u.Active, u.AccountType)
+		if err != nil {
+			return fmt.Errorf("could not insert values in the table: %w", err)
+		}
+	}
+	return nil
+}
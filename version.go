@@ -0,0 +1,101 @@
+package camembert
+
+import "strings"
+
+// APIVersion identifies the version of the Jira REST API, which decides the
+// shape of some issue fields. Jira Server returns users by name and plain
+// text descriptions (v2), while Jira Cloud v3 returns users by account ID and
+// descriptions in the Atlassian Document Format.
+type APIVersion int
+
+const (
+	// APIVersionAuto detects the version from the path of JiraBaseURL.
+	APIVersionAuto APIVersion = 0
+	APIVersion2    APIVersion = 2
+	APIVersion3    APIVersion = 3
+)
+
+// userIDPaths lists, per API version, where the identity of a user lives in
+// the user objects embedded in issue fields.
+var userIDPaths = map[APIVersion]string{
+	APIVersion2: "name",
+	APIVersion3: "accountId",
+}
+
+// IssueUser is a user referenced by an issue. ID is the user name on v2 and
+// the account ID on v3.
+type IssueUser struct {
+	ID          string
+	DisplayName string
+}
+
+// apiVersion returns the configured version, detecting it when unset.
+func (c Config) apiVersion() APIVersion {
+	if c.APIVersion != APIVersionAuto {
+		return c.APIVersion
+	}
+	if c.Endpoint == EndpointServiceDesk || strings.Contains(c.JiraBaseURL, "/rest/api/3/") {
+		return APIVersion3
+	}
+	return APIVersion2
+}
+
+// version returns the API version the issue was fetched with, assuming v2
+// for issues that were not fetched by Export.
+func (i JiraIssue) version() APIVersion {
+	if i.apiVersion == APIVersionAuto {
+		return APIVersion2
+	}
+	return i.apiVersion
+}
+
+func (i JiraIssue) user(field string) IssueUser {
+	return IssueUser{
+		ID:          fieldValue(i.Fields, field+"."+userIDPaths[i.version()]),
+		DisplayName: fieldValue(i.Fields, field+".displayName"),
+	}
+}
+
+// Assignee returns the assignee of the issue, or a zero IssueUser.
+func (i JiraIssue) Assignee() IssueUser { return i.user("assignee") }
+
+// Reporter returns the reporter of the issue, or a zero IssueUser.
+func (i JiraIssue) Reporter() IssueUser { return i.user("reporter") }
+
+// Creator returns the creator of the issue, or a zero IssueUser.
+func (i JiraIssue) Creator() IssueUser { return i.user("creator") }
+
+// Description returns the description of the issue as plain text.
+func (i JiraIssue) Description() string {
+	switch d := i.Fields["description"].(type) {
+	case string:
+		return d
+	case map[string]interface{}:
+		return strings.TrimSpace(adfText(d))
+	default:
+		return ""
+	}
+}
+
+// adfText extracts the text of an Atlassian Document Format node, separating
+// block nodes with newlines.
+func adfText(node map[string]interface{}) string {
+	var b strings.Builder
+	if text, ok := node["text"].(string); ok {
+		b.WriteString(text)
+	}
+	if node["type"] == "hardBreak" {
+		b.WriteString("\n")
+	}
+	content, _ := node["content"].([]interface{})
+	for _, child := range content {
+		if child, ok := child.(map[string]interface{}); ok {
+			b.WriteString(adfText(child))
+		}
+	}
+	switch node["type"] {
+	case "paragraph", "heading", "codeBlock", "listItem", "blockquote", "rule":
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,175 @@
+package camembert
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// VisibilityOutput configures the export of the visibility of the comments
+// and worklogs of issues, one row per comment or worklog. Comments and
+// worklogs restricted to a role or group get the type and value of the
+// restriction, the others an empty visibility.
+//
+// Jira leaves out the restricted items the authenticated user cannot see.
+// Each issue whose comment or worklog field counts more items than it holds
+// is reported with a warning: in ExportResult.Omitted for the items missing
+// from the page Jira embeds in the field, and in ExportResult.Truncated for
+// the items beyond that page, such as the worklogs after the first 20.
+//
+// Like the sprints and child table rows, the visibility rows of every issue
+// are kept in memory until the end of the export, even when streaming.
+type VisibilityOutput struct {
+	// CSVFile, when set, receives the visibility rows.
+	CSVFile string
+	// Table, when set, is created in the database of the DB output.
+	Table string
+}
+
+// visibilityFields holds, for every field listing items with a visibility,
+// the kind of the items and the key of their list.
+var visibilityFields = []struct{ field, kind, list string }{
+	{"comment", "comment", "comments"},
+	{"worklog", "worklog", "worklogs"},
+}
+
+// itemVisibility is the visibility of a comment or worklog.
+type itemVisibility struct {
+	issueID    string
+	issueKey   string
+	kind       string
+	id         string
+	typ        string
+	value      string
+	identifier string
+}
+
+func (e *exporter) addVisibility(issues []JiraIssue) {
+	for _, issue := range issues {
+		for _, f := range visibilityFields {
+			field, ok := issue.Fields[f.field].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			items, _ := field[f.list].([]interface{})
+			for _, item := range items {
+				item, ok := item.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				v := itemVisibility{
+					issueID:    issue.ID,
+					issueKey:   issue.Key,
+					kind:       f.kind,
+					id:         fieldValue(item, "id"),
+					typ:        fieldValue(item, "visibility.type"),
+					value:      fieldValue(item, "visibility.value"),
+					identifier: fieldValue(item, "visibility.identifier"),
+				}
+				if v.typ != "" {
+					e.stats.restricted.Add(1)
+				}
+				e.visibility = append(e.visibility, v)
+			}
+			total, err := strconv.Atoi(fieldValue(field, "total"))
+			if err != nil {
+				continue
+			}
+			embedded := total
+			if maxResults, err := strconv.Atoi(fieldValue(field, "maxResults")); err == nil && maxResults < total {
+				embedded = maxResults
+				e.logger.Printf("Warning: issue %s embeds %d of its %d %ss, the others are not exported", issue.Key, maxResults, total, f.kind)
+				e.stats.truncated.Add(int64(total - maxResults))
+			}
+			if hidden := embedded - len(items); hidden > 0 {
+				e.logger.Printf("Warning: issue %s holds %d of the %d %ss Jira embeds, the others may be restricted", issue.Key, len(items), embedded, f.kind)
+				e.stats.omitted.Add(int64(hidden))
+			}
+		}
+	}
+}
+
+func (e *exporter) exportVisibility(output VisibilityOutput) error {
+	if output.CSVFile != "" {
+		if err := e.saveVisibilityToCSV(output.CSVFile); err != nil {
+			return err
+		}
+	}
+	if output.Table != "" {
+		if err := e.saveVisibilityToDB(e.cfg.DB.File, output.Table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *exporter) saveVisibilityToCSV(csvFile string) error {
+	e.logger.Printf("Saving comment and worklog visibility to CSV file: %s", csvFile)
+	file, err := os.Create(csvFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	headers := []string{"IssueID", "IssueKey", "Kind", "ID", "VisibilityType", "VisibilityValue", "VisibilityIdentifier"}
+	if err := writer.Write(headers); err != nil {
+		return fmt.Errorf("failed to write CSV headers: %w", err)
+	}
+	for _, v := range e.visibility {
+		record := []string{v.issueID, v.issueKey, v.kind, v.id, v.typ, v.value, v.identifier}
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("failed to write data in CSV file: %w", err)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write data in CSV file: %w", err)
+	}
+	return nil
+}
+
+func (e *exporter) saveVisibilityToDB(dbFile string, tableName string) error {
+	e.logger.Printf("Saving comment and worklog visibility to DB file %s in table %s.", dbFile, tableName)
+
+	db, err := e.openDB(dbFile)
+	if err != nil {
+		return err
+	}
+	defer e.releaseDB(db)
+
+	createTableSQL := fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s (
+		issue_id TEXT,
+		issue_key TEXT,
+		kind TEXT,
+		id TEXT,
+		visibility_type TEXT,
+		visibility_value TEXT,
+		visibility_identifier TEXT,
+		PRIMARY KEY (kind, id)
+	);`, tableName)
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin a transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(createTableSQL); err != nil {
+		return fmt.Errorf("failed to create the table in the database: %w", err)
+	}
+
+	insertSQL := fmt.Sprintf(`INSERT OR REPLACE INTO %s (issue_id, issue_key, kind, id, visibility_type, visibility_value, visibility_identifier) VALUES (?, ?, ?, ?, ?, ?, ?)`, tableName)
+	for _, v := range e.visibility {
+		_, err := tx.Exec(insertSQL, v.issueID, v.issueKey, v.kind, v.id, v.typ, v.value, v.identifier)
+		if err != nil {
+			return fmt.Errorf("could not insert values in the table: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit the transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package camembert
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVisibilityCounters(t *testing.T) {
+	restricted := map[string]interface{}{"id": "2", "visibility": map[string]interface{}{"type": "role", "value": "Developers"}}
+	public := map[string]interface{}{"id": "1"}
+	tests := []struct {
+		name           string
+		worklog        map[string]interface{}
+		wantRestricted int
+		wantOmitted    int
+		wantTruncated  int
+	}{
+		{name: "complete", worklog: map[string]interface{}{"total": 2, "maxResults": 20, "worklogs": []interface{}{public, restricted}}, wantRestricted: 1},
+		{name: "hidden", worklog: map[string]interface{}{"total": 3, "maxResults": 20, "worklogs": []interface{}{public}}, wantOmitted: 2},
+		{name: "truncated", worklog: map[string]interface{}{"total": 25, "maxResults": 2, "worklogs": []interface{}{public, restricted}}, wantRestricted: 1, wantTruncated: 23},
+		{name: "truncated and hidden", worklog: map[string]interface{}{"total": 25, "maxResults": 20, "worklogs": []interface{}{public}}, wantOmitted: 19, wantTruncated: 5},
+		{name: "no page size", worklog: map[string]interface{}{"total": 2, "worklogs": []interface{}{public}}, wantOmitted: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jira := &fakeJira{total: 1, edit: func(i int, issue map[string]interface{}) {
+				issue["fields"].(map[string]interface{})["worklog"] = tt.worklog
+			}}
+			cfg := jira.start(t)
+			cfg.Writers = []Writer{&keyWriter{}}
+			cfg.Visibility = &VisibilityOutput{CSVFile: filepath.Join(t.TempDir(), "visibility.csv")}
+			result, err := Export(context.Background(), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Restricted != tt.wantRestricted || result.Omitted != tt.wantOmitted || result.Truncated != tt.wantTruncated {
+				t.Errorf("Restricted, Omitted, Truncated = %d, %d, %d, want %d, %d, %d",
+					result.Restricted, result.Omitted, result.Truncated, tt.wantRestricted, tt.wantOmitted, tt.wantTruncated)
+			}
+		})
+	}
+}
+
+func TestVisibilityTable(t *testing.T) {
+	jira := &fakeJira{total: 2, edit: func(i int, issue map[string]interface{}) {
+		issue["fields"].(map[string]interface{})["comment"] = map[string]interface{}{"total": 1, "maxResults": 20, "comments": []interface{}{
+			map[string]interface{}{"id": fmt.Sprint(100 + i), "visibility": map[string]interface{}{"type": "group", "value": "staff", "identifier": "g-1"}},
+		}}
+	}}
+	file := filepath.Join(t.TempDir(), "issues.db")
+	cfg := jira.start(t)
+	cfg.DB = &DBOutput{File: file, Table: "issues"}
+	cfg.Visibility = &VisibilityOutput{Table: "visibility"}
+	if _, err := Export(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite3", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	rows, err := db.Query("SELECT issue_key, kind, id, visibility_type, visibility_value, visibility_identifier FROM visibility ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got [][]string
+	for rows.Next() {
+		row := make([]string, 6)
+		if err := rows.Scan(&row[0], &row[1], &row[2], &row[3], &row[4], &row[5]); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, row)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"P-0", "comment", "100", "group", "staff", "g-1"}, {"P-1", "comment", "101", "group", "staff", "g-1"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("visibility rows = %v, want %v", got, want)
+	}
+}
+
+func TestVisibilityCSVWriteError(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("no /dev/full to fail writes")
+	}
+	jira := &fakeJira{total: 1, edit: func(i int, issue map[string]interface{}) {
+		issue["fields"].(map[string]interface{})["comment"] = map[string]interface{}{"total": 1, "maxResults": 20, "comments": []interface{}{
+			map[string]interface{}{"id": "100", "visibility": map[string]interface{}{"type": "role", "value": "Developers"}},
+		}}
+	}}
+	cfg := jira.start(t)
+	cfg.Writers = []Writer{&keyWriter{}}
+	cfg.OnExisting = ExistingOverwrite
+	cfg.Visibility = &VisibilityOutput{CSVFile: "/dev/full"}
+	if _, err := Export(context.Background(), cfg); err == nil {
+		t.Error("Export() succeeded, want the error writing the visibility CSV file")
+	}
+}
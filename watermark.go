@@ -0,0 +1,165 @@
+package camembert
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// WatermarkStore persists the watermark of incremental exports, the time from
+// which the next export selects the updated issues. Load returns the zero
+// time when no watermark is stored yet. Implementations may keep it anywhere,
+// such as in Redis or S3 for stateless scheduled exports.
+type WatermarkStore interface {
+	Load() (time.Time, error)
+	Save(time.Time) error
+}
+
+// FileWatermark returns a store keeping the watermark in file as an RFC 3339
+// timestamp. The file is replaced atomically on every save.
+func FileWatermark(file string) WatermarkStore {
+	return fileWatermark{file: file}
+}
+
+type fileWatermark struct {
+	file string
+}
+
+func (w fileWatermark) Load() (time.Time, error) {
+	data, err := os.ReadFile(w.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(data)))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid watermark in %s: %w", w.file, err)
+	}
+	return t, nil
+}
+
+func (w fileWatermark) Save(t time.Time) error {
+	tmp, err := os.CreateTemp(filepath.Dir(w.file), filepath.Base(w.file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(t.Format(time.RFC3339Nano) + "\n"); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), w.file)
+}
+
+// TableWatermark returns a store keeping the watermark in table of the SQLite
+// database dbFile, in the row named name, so that the exports of several
+// projects can share the table. The table is created on first save.
+func TableWatermark(dbFile, table, name string) WatermarkStore {
+	return tableWatermark{file: dbFile, table: table, name: name}
+}
+
+type tableWatermark struct {
+	file  string
+	table string
+	name  string
+}
+
+// open opens the database, locked for the exports of the process.
+func (w tableWatermark) open() (*sql.DB, func(), error) {
+	unlock := dbLocks.lock(dbLockKey(w.file))
+	db, err := sql.Open("sqlite3", w.file)
+	if err != nil {
+		unlock()
+		return nil, nil, fmt.Errorf("failed to open database file: %w", err)
+	}
+	return db, func() {
+		db.Close()
+		unlock()
+	}, nil
+}
+
+func (w tableWatermark) Load() (time.Time, error) {
+	db, closeDB, err := w.open()
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer closeDB()
+
+	var exists int
+	err = db.QueryRow(`SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, w.table).Scan(&exists)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to look up the watermark table: %w", err)
+	}
+	if exists == 0 {
+		return time.Time{}, nil
+	}
+	var value string
+	err = db.QueryRow(fmt.Sprintf(`SELECT watermark FROM %s WHERE name = ?`, w.table), w.name).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read the watermark: %w", err)
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid watermark %s in table %s: %w", w.name, w.table, err)
+	}
+	return t, nil
+}
+
+func (w tableWatermark) Save(t time.Time) error {
+	db, closeDB, err := w.open()
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	createTableSQL := fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s (
+		name TEXT PRIMARY KEY,
+		watermark TEXT
+	);`, w.table)
+	if _, err := db.Exec(createTableSQL); err != nil {
+		return fmt.Errorf("failed to create the table in the database: %w", err)
+	}
+	insertSQL := fmt.Sprintf(`INSERT OR REPLACE INTO %s (name, watermark) VALUES (?, ?)`, w.table)
+	if _, err := db.Exec(insertSQL, w.name, t.Format(time.RFC3339Nano)); err != nil {
+		return fmt.Errorf("could not insert values in the table: %w", err)
+	}
+	return nil
+}
+
+// watermarkMargin is subtracted from the watermark, so that issues updated
+// while the previous export started are fetched again rather than missed
+// when the clocks of Jira and of the export differ.
+const watermarkMargin = time.Minute
+
+// loadWatermark sets UpdatedSince from Config.Watermark. Until a watermark is
+// stored, every issue is exported with all its fields.
+func (e *exporter) loadWatermark() error {
+	since, err := e.cfg.Watermark.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load the watermark: %w", err)
+	}
+	if since.IsZero() {
+		e.logger.Println("No watermark stored yet, exporting every issue.")
+		if e.cfg.ChangedFieldsOnly {
+			e.cfg.ChangedFieldsOnly = false
+			e.source = e.cfg.source()
+		}
+		return nil
+	}
+	e.logger.Printf("Exporting issues updated since the watermark %s, less %s", since.Format(time.RFC3339), watermarkMargin)
+	e.cfg.UpdatedSince = since.Add(-watermarkMargin)
+	return nil
+}
@@ -0,0 +1,130 @@
+package camembert
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatermarkQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeZone string
+		want     string
+	}{
+		{name: "user time zone", timeZone: "Asia/Kolkata", want: `project=P AND updated >= "2024-05-01 15:29"`},
+		{name: "UTC", timeZone: "UTC", want: `project=P AND updated >= "2024-05-01 09:59"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "watermark")
+			if err := os.WriteFile(file, []byte("2024-05-01T10:00:30Z\n"), 0o666); err != nil {
+				t.Fatal(err)
+			}
+			recorder := &RequestRecorder{}
+			cfg := (&fakeJira{total: 3, timeZone: tt.timeZone}).start(t)
+			cfg.Watermark = FileWatermark(file)
+			cfg.Recorder = recorder
+			cfg.Writers = []Writer{&keyWriter{}}
+			startedAt := time.Now()
+			if _, err := Export(context.Background(), cfg); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, req := range recorder.Requests() {
+				if jql := req.Query.Get("jql"); jql != "" && jql != tt.want {
+					t.Errorf("JQL = %s, want %s", jql, tt.want)
+				}
+			}
+			saved, err := FileWatermark(file).Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if saved.Before(startedAt.Add(-time.Second)) {
+				t.Errorf("watermark = %s, want the start of the export", saved)
+			}
+		})
+	}
+}
+
+func TestWatermarkKeptAfterFailedPages(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "watermark")
+	const stored = "2024-05-01T10:00:30Z\n"
+	if err := os.WriteFile(file, []byte(stored), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	jira := &fakeJira{total: 3 * pageSize, timeZone: "UTC"}
+	cfg := serve(t, &flakyJira{fakeJira: jira, failAt: pageSize, attempts: make(map[int]int)})
+	cfg.MaxRetries = 1
+	cfg.RetryBackoff = time.Millisecond
+	cfg.Watermark = FileWatermark(file)
+	cfg.Writers = []Writer{&keyWriter{}}
+	result, err := Export(context.Background(), cfg)
+	if err == nil || !strings.Contains(err.Error(), "leaving the watermark") {
+		t.Errorf("Export() error = %v, want the watermark left", err)
+	}
+	if result.FailedPages != 1 {
+		t.Errorf("FailedPages = %d, want 1", result.FailedPages)
+	}
+	if data, _ := os.ReadFile(file); string(data) != stored {
+		t.Errorf("watermark = %q, want %q", data, stored)
+	}
+}
+
+func TestWatermarkLocalTimeZoneFallback(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "watermark")
+	if err := os.WriteFile(file, []byte("2024-05-01T10:00:30Z\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	recorder := &RequestRecorder{}
+	cfg := (&fakeJira{total: 1}).start(t)
+	cfg.Watermark = FileWatermark(file)
+	cfg.Recorder = recorder
+	cfg.Writers = []Writer{&keyWriter{}}
+	if _, err := Export(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	since := time.Date(2024, 5, 1, 9, 59, 30, 0, time.UTC).In(time.Local).Format(jqlTimeLayout)
+	for _, req := range recorder.Requests() {
+		if jql := req.Query.Get("jql"); jql != "" && !strings.Contains(jql, since) {
+			t.Errorf("JQL = %s, want the watermark in the local time zone, %s", jql, since)
+		}
+	}
+}
+
+func TestConsistentCutoff(t *testing.T) {
+	for _, timeZone := range []string{"Asia/Kolkata", "America/New_York"} {
+		t.Run(timeZone, func(t *testing.T) {
+			zone, err := time.LoadLocation(timeZone)
+			if err != nil {
+				t.Skip(err)
+			}
+			recorder := &RequestRecorder{}
+			cfg := (&fakeJira{total: 3, timeZone: timeZone}).start(t)
+			cfg.Consistent = true
+			cfg.Recorder = recorder
+			cfg.Writers = []Writer{&keyWriter{}}
+			before := time.Now()
+			if _, err := Export(context.Background(), cfg); err != nil {
+				t.Fatal(err)
+			}
+			after := time.Now()
+
+			// The cutoff is the minute the export started in, in the zone of
+			// the user, unless the minute changed during the test.
+			var wants []string
+			for _, at := range []time.Time{before, after} {
+				wants = append(wants, fmt.Sprintf(`project=P AND created < "%s" ORDER BY created ASC, key ASC`, at.In(zone).Format(jqlTimeLayout)))
+			}
+			for _, req := range recorder.Requests() {
+				if jql := req.Query.Get("jql"); jql != "" && jql != wants[0] && jql != wants[1] {
+					t.Errorf("JQL = %s, want %s", jql, wants[0])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package camembert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Writer is an output of an export. Issues are handed to it in batches as the
+// export progresses: all at once after the last page has been fetched, or
+// page by page when streaming. Batches are shared between writers and must
+// not be modified. Close finalizes the output after a successful export, and
+// Abort releases it after a failed one.
+type Writer interface {
+	WriteIssues(ctx context.Context, issues []JiraIssue) error
+	Close() error
+	Abort() error
+}
+
+// FieldsFormat selects the representation of the fields of the issues handed
+// to a Writer.
+type FieldsFormat int
+
+const (
+	// FieldsDecoded hands over the decoded JiraIssue.Fields only.
+	FieldsDecoded FieldsFormat = iota
+	// FieldsEncoded sets JiraIssue.FieldsJSON as well. The fields of every
+	// issue are encoded once, whatever the number of writers asking for
+	// them, and the encoded form is held until the batch is written.
+	FieldsEncoded
+)
+
+// FieldsFormatter is implemented by writers declaring the representation of
+// the fields they need. Writers not implementing it get FieldsDecoded.
+type FieldsFormatter interface {
+	FieldsFormat() FieldsFormat
+}
+
+// wantsEncodedFields reports whether w asks for FieldsEncoded.
+func wantsEncodedFields(w Writer) bool {
+	formatter, ok := w.(FieldsFormatter)
+	return ok && formatter.FieldsFormat() == FieldsEncoded
+}
+
+// encodeFields sets the FieldsJSON of issues.
+func encodeFields(issues []JiraIssue) {
+	for i := range issues {
+		if issues[i].FieldsJSON == nil {
+			issues[i].FieldsJSON, _ = marshalFields(issues[i])
+		}
+	}
+}
+
+// fieldsJSON returns the encoded fields of issue, encoding them unless
+// already done.
+func fieldsJSON(issue JiraIssue) string {
+	if issue.FieldsJSON != nil {
+		return string(issue.FieldsJSON)
+	}
+	data, _ := marshalFields(issue)
+	return string(data)
+}
+
+// openWriters opens a writer for every configured output.
+func (e *exporter) openWriters(ctx context.Context) (*writerGroup, error) {
+	var writers []Writer
+	if e.cfg.CSV != nil {
+		w, err := e.newCSVWriter(*e.cfg.CSV)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save issues to CSV: %w", err)
+		}
+		writers = append(writers, w)
+	}
+	if e.cfg.DB != nil {
+		w, err := e.newDBWriter(*e.cfg.DB)
+		if err != nil {
+			for _, w := range writers {
+				w.Abort()
+			}
+			return nil, fmt.Errorf("failed to save issues to database: %w", err)
+		}
+		writers = append(writers, w)
+	}
+	if e.cfg.Markdown != nil {
+		w, err := e.newMarkdownWriter(*e.cfg.Markdown)
+		if err != nil {
+			for _, w := range writers {
+				w.Abort()
+			}
+			return nil, fmt.Errorf("failed to save issues as Markdown: %w", err)
+		}
+		writers = append(writers, w)
+	}
+	if e.cfg.OnChunk != nil {
+		writers = append(writers, e.newChunkWriter())
+	}
+	writers = append(writers, e.cfg.Writers...)
+	return newWriterGroup(ctx, writers, e.cfg.ConcurrentWrites), nil
+}
+
+// writerGroup hands every batch to each of its writers. With concurrent
+// writes, each writer consumes batches from its own channel in its own
+// goroutine, and the first error is reported by the next write or by close.
+type writerGroup struct {
+	writers []Writer
+	batches []chan []JiraIssue
+	wg      sync.WaitGroup
+	// encode is set when a writer asks for FieldsEncoded.
+	encode bool
+
+	mu  sync.Mutex
+	err error
+}
+
+func newWriterGroup(ctx context.Context, writers []Writer, concurrent bool) *writerGroup {
+	g := &writerGroup{writers: writers}
+	for _, w := range writers {
+		g.encode = g.encode || wantsEncodedFields(w)
+	}
+	if !concurrent {
+		return g
+	}
+	for _, w := range writers {
+		batches := make(chan []JiraIssue, 1)
+		g.batches = append(g.batches, batches)
+		g.wg.Add(1)
+		go func() {
+			defer g.wg.Done()
+			// Batches keep being consumed after a failure so that write
+			// never blocks on a failed writer.
+			for issues := range batches {
+				if g.failed() != nil {
+					continue
+				}
+				if err := w.WriteIssues(ctx, issues); err != nil {
+					g.fail(err)
+				}
+			}
+		}()
+	}
+	return g
+}
+
+func (g *writerGroup) fail(err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.err == nil {
+		g.err = err
+	}
+}
+
+func (g *writerGroup) failed() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.err
+}
+
+func (g *writerGroup) write(ctx context.Context, issues []JiraIssue) error {
+	if g.encode {
+		encodeFields(issues)
+	}
+	if g.batches == nil {
+		for _, w := range g.writers {
+			if err := w.WriteIssues(ctx, issues); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := g.failed(); err != nil {
+		return err
+	}
+	for _, batches := range g.batches {
+		select {
+		case batches <- issues:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// wait stops the writer goroutines once they have consumed every batch.
+func (g *writerGroup) wait() error {
+	for _, batches := range g.batches {
+		close(batches)
+	}
+	g.batches = nil
+	g.wg.Wait()
+	return g.failed()
+}
+
+// close waits for the pending batches and finalizes every writer, unless one
+// of them failed, in which case they are all aborted.
+func (g *writerGroup) close() error {
+	if err := g.wait(); err != nil {
+		g.abortWriters()
+		return err
+	}
+	var errs []error
+	for _, w := range g.writers {
+		errs = append(errs, w.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (g *writerGroup) abort() {
+	g.wait()
+	g.abortWriters()
+}
+
+func (g *writerGroup) abortWriters() {
+	for _, w := range g.writers {
+		w.Abort()
+	}
+}